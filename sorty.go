@@ -11,28 +11,84 @@
 //	import "github.com/jfcg/sorty/v2"
 //
 //	sorty.SortSlice(native_slice) // []int, []float64, []string, []*T etc. in ascending order
+//	sorty.SortSliceOf(slice)      // same as SortSlice with compile-time type checking
 //	sorty.SortLen(len_slice)      // []string or [][]T 'by length' in ascending order
+//	sorty.SortSliceDesc(slice)    // also SortLenDesc, in descending order
 //	sorty.Sort(n, lesswap)        // lesswap() based
+//	sorty.SortStable(n, lesswap)  // lesswap() based, keeps order of equal elements
+//	sorty.PartialSortSlice(s, k)  // also PartialSort, sorts k smallest to s[:k]
+//	sorty.NthElementSlice(s, k)   // also NthElement, SelectSlice & Select for many ranks
+//	sorty.ArgSortSlice(slice)     // also ArgSort, sorting permutation, slice is not modified
+//	sorty.SortPairs(keys, col..)  // sorts keys, moves payload columns in lockstep
+//	sorty.SortByKey(slice, key)   // key() is called once per member
 //
 // [QuickSort]: https://en.wikipedia.org/wiki/Quicksort
 package sorty
 
 import (
+	"context"
+	"fmt"
+	"math/bits"
 	"reflect"
+	"runtime/debug"
+	"runtime/trace"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/jfcg/sixb"
 )
 
 // MaxGor is the maximum number of goroutines (including caller) that can be
-// concurrently used for sorting per Sort*() call. MaxGor can be changed live, even
-// during ongoing Sort*() calls. MaxGor ≤ 1 (or a short input) yields single-goroutine
-// sorting: sorty will not create any goroutines or channel.
-var MaxGor uint64 = 3
+// concurrently used for sorting per Sort*() call. By default it is [AutoGor], which
+// follows available CPUs. MaxGor can be changed live, even during ongoing Sort*()
+// calls. MaxGor ≤ 1 (or a short input) yields single-goroutine sorting: sorty will
+// not create any goroutines or channel. See [Sorter] for per-call values and
+// [GorBudget] for a limit shared by all calls.
+var MaxGor = AutoGor
+
+// Budget limits the total number of helper goroutines (excluding callers) that all
+// Sort*() calls sharing it can use concurrently, in addition to per-call MaxGor.
+// Helpers are drawn from it atomically before they are created, so simultaneous
+// calls cannot exceed it (unless Max is lowered live). See [GorBudget] and [Sorter].
+type Budget struct {
+	// Max is the maximum number of helper goroutines, it can be changed live.
+	// For example runtime.GOMAXPROCS(0) caps total sorting parallelism per CPU.
+	Max  uint64
+	used uint64 // helper goroutines in use
+}
+
+// Used returns the number of helper goroutines currently drawn from b.
+func (b *Budget) Used() uint64 {
+	return atomic.LoadUint64(&b.used)
+}
+
+// acquire draws d helpers from b only if it has d free helpers
+//
+//go:norace
+func (b *Budget) acquire(d uint64) bool {
+	for {
+		u := atomic.LoadUint64(&b.used)
+		if u+d > b.Max {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&b.used, u, u+d) {
+			return true
+		}
+	}
+}
+
+// GorBudget is an optional goroutine budget shared by all Sort*() calls that use
+// package-level values, it is nil (no budget) by default. For example:
+//
+//	sorty.GorBudget = &sorty.Budget{Max: uint64(runtime.GOMAXPROCS(0))}
+//
+// It is read at the start of each Sort*() call.
+var GorBudget *Budget
 
 func init() {
-	if !(4097 > MaxGor && MaxGor > 0 && MaxLenRec > MaxLenRecFC && MaxLenRecFC >
-		2*MaxLenIns && MaxLenIns > MaxLenInsFC && MaxLenInsFC > 2*nsShort) {
+	if !((4097 > MaxGor || MaxGor == AutoGor) && MaxGor > 0 &&
+		MaxLenRec > MaxLenRecFC && MaxLenRecFC > 2*MaxLenIns &&
+		MaxLenIns > MaxLenInsFC && MaxLenInsFC > 2*nsShort) {
 		panic("sorty: check your MaxGor/MaxLen* values")
 	}
 }
@@ -47,9 +103,11 @@ const (
 
 // NaNoption determines how sorty handles [NaNs] in [SortSlice]() and [IsSortedSlice]().
 // NaNs can be treated as smaller than, ignored or larger than other float values.
-// By default NaNs will end up at the end of your ascending-sorted slice. If your slice
-// contains NaNs and you choose to ignore them, the result is undefined behavior, and
-// almost always not sorted properly. sorty is only tested with small/large options.
+// By default NaNs will end up at the end of your ascending-sorted slice. Descending
+// order is the exact reverse, so [SortSliceDesc]() puts large NaNs at the start.
+// If your slice contains NaNs and you choose to ignore them, the result is undefined
+// behavior, and almost always not sorted properly. sorty is only tested with
+// small/large options.
 //
 // [NaNs]: https://en.wikipedia.org/wiki/NaN
 var NaNoption = NaNlarge
@@ -77,18 +135,165 @@ func Search(n int, fn func(int) bool) int {
 	return l
 }
 
-// synchronization variables for [g]long*()
+// per-call parameters & synchronization variables for sort*() and [g]long*()
 type syncVar struct {
-	nGor uint64   // number of sorting goroutines
-	done chan int // end signal
+	nGor   uint64   // number of sorting goroutines
+	done   chan int // end signal
+	maxGor *uint64  // max goroutines, can change live
+	budget *Budget  // optional budget shared with other calls
+	auto   uint64   // automatic max goroutines of this call, 0 until evaluated
+	ins    int      // max slice length for insertion sort
+	rec    int      // max slice length for recursion
+	nan    FloatOption
+	stop   <-chan struct{} // cancellation signal
+	pnc    atomic.Value    // first *HelperPanic of this call, cancels sorting
+	st     *callStats      // optional statistics
+	tc     context.Context // tracing context, nil if not tracing
+	task   *trace.Task     // runtime/trace task of concurrent sorting
+	reg    *trace.Region   // runtime/trace region of the calling goroutine
+	lbl    bool            // set pprof labels of tc on helper goroutines
+}
+
+// HelperPanic is the value a Sort*() call panics with on the calling goroutine when
+// one of its helper goroutines panics, for example due to an out-of-range index in a
+// [Lesswap]. Remaining goroutines of the call are stopped and awaited first, so the
+// collection is in an unspecified order but no longer accessed by sorty.
+type HelperPanic struct {
+	Value any    // original panic value
+	Stack []byte // stack of the helper goroutine when it panicked
 }
 
-// gorFull returns true if goroutine quota is full, inlined
+func (p *HelperPanic) Error() string {
+	return fmt.Sprintf("sorty: helper goroutine panicked: %v\n\n%s", p.Value, p.Stack)
+}
+
+// Unwrap returns the original panic value if it is an error, nil otherwise.
+func (p *HelperPanic) Unwrap() error {
+	err, _ := p.Value.(error)
+	return err
+}
+
+// fail records panic p with current stack if it is the first of the call
+func (sv *syncVar) fail(p any) {
+	sv.pnc.CompareAndSwap(nil, &HelperPanic{p, debug.Stack()})
+}
+
+// rethrow panics with the first panic of helper goroutines, if any
+func (sv *syncVar) rethrow() {
+	if p := sv.pnc.Load(); p != nil {
+		panic(p)
+	}
+}
+
+// gEnd is deferred by helper goroutines. It records a panic, signals ch if not nil,
+// decreases goroutine counter and signals end if last.
+func gEnd(sv *syncVar, ch chan int) {
+	if p := recover(); p != nil {
+		sv.fail(p) // cancels sorting
+	}
+	if ch != nil {
+		ch <- 0
+	}
+	if subGor(sv, 1) == 0 { // decrease goroutine counters
+		sv.done <- 0 // we are the last, all done
+	}
+}
+
+// quit is deferred by the calling goroutine of concurrent sorting, after creating
+// sv.done. It waits for helper goroutines, even if the caller panics, and panics
+// again with the caller's or first helper's panic.
+func (sv *syncVar) quit() {
+	p := recover()
+	if p != nil {
+		sv.fail(p) // cancel helpers
+	}
+	sv.leave() // in case we panicked in a region
+	sv.phase(sortPhase)
+	sv.enter(regionWait)
+	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
+		<-sv.done // we are not the last, wait
+	}
+	sv.leave()
+	sv.phase(waitPhase)
+	sv.endTask()
+	if p != nil {
+		panic(p)
+	}
+	sv.rethrow()
+}
+
+// join is deferred by the calling goroutine after starting g-1 helpers that signal
+// ch via gEnd. It waits for them, even if the caller panics, and panics again with
+// the caller's or first helper's panic.
+func (sv *syncVar) join(g int, ch chan int) {
+	p := recover()
+	if p != nil {
+		sv.fail(p) // cancel helpers
+	}
+	sv.phase(sortPhase)
+	for ; g > 1; g-- {
+		<-ch
+	}
+	sv.phase(waitPhase)
+	if p != nil {
+		panic(p)
+	}
+	sv.rethrow()
+}
+
+// gorFull returns true if goroutine quota or budget is full. It is called when
+// helpers are possible, so it evaluates AutoGor of the call if needed.
 //
 //go:norace
 func gorFull(sv *syncVar) bool {
-	mg := MaxGor
-	return sv.nGor >= mg
+	if b := sv.budget; b != nil && b.used >= b.Max {
+		return true
+	}
+	return sv.nGor >= sv.maxG()
+}
+
+// oneGor is the max goroutines of single-goroutine calls, it never changes
+var oneGor uint64 = 1
+
+// single pins sv to its calling goroutine, so that long*() cannot create goroutines
+// without an end signal even if MaxGor or budget change live. It returns previous
+// values to restore afterwards.
+func single(sv *syncVar) (*uint64, *Budget) {
+	mg, b := sv.maxGor, sv.budget
+	sv.maxGor, sv.budget = &oneGor, nil
+	return mg, b
+}
+
+// addGor increases goroutine counters of sv & its budget by d. It returns false
+// without changing them if the budget does not have d free helpers.
+func addGor(sv *syncVar, d uint64) bool {
+	if b := sv.budget; b != nil && !b.acquire(d) {
+		return false
+	}
+	sv.gorStat(d, atomic.AddUint64(&sv.nGor, d))
+	return true
+}
+
+// subGor decreases goroutine counters of sv & its budget by d, returns the
+// remaining number of goroutines of sv
+func subGor(sv *syncVar, d uint64) uint64 {
+	if b := sv.budget; b != nil {
+		atomic.AddUint64(&b.used, -d)
+	}
+	return atomic.AddUint64(&sv.nGor, -d)
+}
+
+// canceled returns true if sorting is canceled, inlined
+func canceled(sv *syncVar) bool {
+	if sv.pnc.Load() != nil { // a goroutine panicked
+		return true
+	}
+	select {
+	case <-sv.stop: // never ready for nil stop
+		return true
+	default:
+		return false
+	}
 }
 
 const (
@@ -98,6 +303,10 @@ const (
 	nsConc  = 8 // dual range
 )
 
+// max distance a misplaced member can be moved by run*() so that they finish in
+// linear time (like partial insertion sort of pdqsort)
+const maxShift = 8
+
 // Given n ≥ 2 and slice length ≥ 2n, select n equidistant samples
 // from slice that minimizes max distance to non-selected members, inlined
 func minMaxSample(slen, n uint) (first, step, last uint) {
@@ -126,6 +335,13 @@ func minMaxFour(slen uint32) (first, step uint32) {
 	return
 }
 
+// maxDepth returns partitioning budget for a range of length n. Beyond that,
+// sorty falls back to heapsort (like introsort) so adversarial inputs cannot
+// drive quadratic time, inlined
+func maxDepth(n int) int {
+	return 2 * bits.Len(uint(n))
+}
+
 // inlined
 func insertionI(slc []int) {
 	if unsafe.Sizeof(int(0)) == 8 {
@@ -135,7 +351,14 @@ func insertionI(slc []int) {
 	}
 }
 
-const sliceBias reflect.Kind = 100
+const (
+	sliceBias reflect.Kind = 100
+
+	// hardware kinds of int, uint and pointer types
+	intKind  = reflect.Int32 + reflect.Kind(unsafe.Sizeof(int(0))>>3)
+	uintKind = reflect.Uint32 + reflect.Kind(unsafe.Sizeof(uint(0))>>3)
+	uptrKind = reflect.Uint32 + reflect.Kind(unsafe.Sizeof(uintptr(0))>>3)
+)
 
 // extracts slice and element kind from ar
 //
@@ -151,11 +374,11 @@ func extractSK(ar any) (slc sixb.Slice, kind reflect.Kind) {
 	switch kind {
 	// map int/uint/pointer types to hardware type
 	case reflect.Uintptr, reflect.Pointer, reflect.UnsafePointer:
-		kind = reflect.Uint32 + reflect.Kind(unsafe.Sizeof(uintptr(0))>>3)
+		kind = uptrKind
 	case reflect.Uint:
-		kind = reflect.Uint32 + reflect.Kind(unsafe.Sizeof(uint(0))>>3)
+		kind = uintKind
 	case reflect.Int:
-		kind = reflect.Int32 + reflect.Kind(unsafe.Sizeof(int(0))>>3)
+		kind = intKind
 	// map []T to sliceBias + Kind(T)
 	case reflect.Slice:
 		kind = sliceBias + tipe.Elem().Kind()
@@ -168,7 +391,7 @@ func extractSK(ar any) (slc sixb.Slice, kind reflect.Kind) {
 	}
 
 	v := reflect.ValueOf(ar)
-	p, l := v.Pointer(), v.Len()
-	slc = sixb.Slice{Data: unsafe.Pointer(p), Len: l, Cap: l}
+	l := v.Len()
+	slc = sixb.Slice{Data: v.UnsafePointer(), Len: l, Cap: l}
 	return
 }
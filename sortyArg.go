@@ -0,0 +1,165 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/jfcg/sixb"
+)
+
+// argKey is the set of hardware key types for arg sorting
+type argKey interface {
+	int32 | int64 | uint32 | uint64 | float32 | float64 | string
+}
+
+// argNative stably sorts indices idx by their keys natively, via sorting (key, index)
+// pairs. Assumes keys of idx are not NaN.
+func argNative[T argKey](key []T, idx []int, sv *syncVar) {
+	ps := make([]pair[T], len(idx))
+	for i, k := range idx {
+		ps[i] = pair[T]{key[k], k}
+	}
+	sortP(ps, sv)
+	for i := range ps {
+		idx[i] = ps[i].idx
+	}
+}
+
+// argNaN stably moves indices of NaN keys to the start (NaNsmall) or to the end
+// (NaNlarge or NaNignore) of identity permutation idx, returns the rest
+func argNaN[T float32 | float64](key []T, idx []int, nan FloatOption) []int {
+	c := 0 // number of NaNs
+	for _, x := range key {
+		if x != x {
+			c++
+		}
+	}
+	if c == 0 {
+		return idx
+	}
+
+	l, m := 0, c // next positions of NaN & other indices
+	if nan != NaNsmall {
+		l, m = len(key)-c, 0
+	}
+	for i, x := range key {
+		if x != x {
+			idx[l] = i
+			l++
+		} else {
+			idx[m] = i
+			m++
+		}
+	}
+	if nan != NaNsmall {
+		return idx[:len(key)-c]
+	}
+	return idx[c:]
+}
+
+// identity returns the identity permutation of length n
+func identity(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// argKind stably sorts identity permutation idx by keys in slc natively, returns
+// false for unrecognized kinds
+func argKind(slc sixb.Slice, kind reflect.Kind, idx []int, sv *syncVar) bool {
+	switch kind {
+	case reflect.Int32:
+		argNative(*(*[]int32)(unsafe.Pointer(&slc)), idx, sv)
+	case reflect.Int64:
+		argNative(*(*[]int64)(unsafe.Pointer(&slc)), idx, sv)
+	case reflect.Uint32:
+		argNative(*(*[]uint32)(unsafe.Pointer(&slc)), idx, sv)
+	case reflect.Uint64:
+		argNative(*(*[]uint64)(unsafe.Pointer(&slc)), idx, sv)
+	case reflect.Float32:
+		key := *(*[]float32)(unsafe.Pointer(&slc))
+		argNative(key, argNaN(key, idx, sv.nan), sv)
+	case reflect.Float64:
+		key := *(*[]float64)(unsafe.Pointer(&slc))
+		argNative(key, argNaN(key, idx, sv.nan), sv)
+	case sliceBias + reflect.Uint8: // [][]byte, compared as strings
+		b := *(*[][]byte)(unsafe.Pointer(&slc))
+		key := make([]string, len(b))
+		for i, x := range b {
+			key[i] = sixb.BtoS(x)
+		}
+		argNative(key, idx, sv)
+	case reflect.String:
+		argNative(*(*[]string)(unsafe.Pointer(&slc)), idx, sv)
+	default:
+		return false
+	}
+	return true
+}
+
+// argSK returns the sorting permutation of slc, or nil for unrecognized kinds
+func argSK(slc sixb.Slice, kind reflect.Kind, srt *Sorter) []int {
+	idx := identity(slc.Len)
+	if !argKind(slc, kind, idx, srt.kindVar(sliceKind(kind))) {
+		return nil
+	}
+	return idx
+}
+
+// argLess returns the sorting permutation of n indices via less()
+func argLess(n int, less func(i, k int) bool, stable bool, sv *syncVar) []int {
+	idx := identity(n)
+	sortLw(n, sv.count(func(i, k, r, s int) bool {
+		a, b := idx[i], idx[k]
+		if less(a, b) || stable && a < b && !less(b, a) {
+			if r != s {
+				idx[r], idx[s] = idx[s], idx[r]
+			}
+			return true
+		}
+		return false
+	}), sv)
+	return idx
+}
+
+// ArgSortSlice concurrently computes and returns the permutation p that sorts ar in
+// ascending order, so ar[p[0]] ≤ ar[p[1]] ≤ .. ar itself is not modified. ar's type
+// can be as in [SortSlice](), otherwise it panics. NaNs are handled as per [NaNoption].
+// Keys are compared natively: members are sorted together with their indices, so it
+// allocates a copy of ar and a word per member in addition to p. Sorting is stable,
+// equal members of ar are in ascending index order in p.
+//
+//go:nosplit
+func ArgSortSlice(ar any) []int {
+	slc, kind := extractSK(ar)
+	if p := argSK(slc, kind, std); p != nil {
+		return p
+	}
+	panic("sorty: ArgSortSlice: invalid input type")
+}
+
+// ArgSort concurrently computes and returns the permutation p that sorts underlying
+// collection of length n in ascending order as per less(), which compares members
+// at indices i & k. The collection itself is not modified, no swap function is
+// needed. Order of equal members in p is unspecified, see [ArgSortStable]().
+//
+//go:nosplit
+func ArgSort(n int, less func(i, k int) bool) []int {
+	return argLess(n, less, false, std.newVar(true))
+}
+
+// ArgSortStable is like [ArgSort]() but equal members are in ascending index
+// order in returned permutation.
+//
+//go:nosplit
+func ArgSortStable(n int, less func(i, k int) bool) []int {
+	return argLess(n, less, true, std.newVar(true))
+}
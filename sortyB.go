@@ -6,11 +6,7 @@
 
 package sorty
 
-import (
-	"sync/atomic"
-
-	"github.com/jfcg/sixb"
-)
+import "github.com/jfcg/sixb"
 
 // isSortedB returns 0 if ar is sorted in ascending lexicographic
 // order, otherwise it returns i > 0 with sixb.BtoS(ar[i]) < sixb.BtoS(ar[i-1]), inlined
@@ -48,12 +44,100 @@ func insertionB(slc [][]byte) {
 	}
 }
 
+// heapB sorts slc in ascending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapB(slc [][]byte) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftB(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftB(slc, 0, n)
+	}
+}
+
+// siftB moves slc[root] down in heap slc[:n], inlined
+func siftB(slc [][]byte, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; sixb.BtoS(top) < sixb.BtoS(nxt) {
+				top = nxt
+				c++
+			}
+		}
+		if sixb.BtoS(val) >= sixb.BtoS(top) {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runB tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runB(slc [][]byte) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if sixb.BtoS(slc[i]) < sixb.BtoS(slc[i-step]) {
+			fwd = false
+		} else if sixb.BtoS(slc[i-step]) < sixb.BtoS(slc[i]) {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if sixb.BtoS(slc[i-1]) < sixb.BtoS(slc[i]) {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if sixb.BtoS(val) >= sixb.BtoS(slc[h-1]) {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && sixb.BtoS(val) < sixb.BtoS(slc[l-1]); l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
 // pivotB selects n equidistant samples from slc that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning.
+// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning
+// and whether samples show duplicates of it.
 //
 //go:nosplit
-func pivotB(slc [][]byte, n uint) string {
+func pivotB(slc [][]byte, n uint) (string, bool) {
 
 	first, step, _ := minMaxSample(uint(len(slc)), n)
 
@@ -64,7 +148,8 @@ func pivotB(slc [][]byte, n uint) string {
 	}
 	insertionS(sample[:n]) // sort n samples
 
-	return sample[n>>1] // return middle sample
+	n >>= 1 // return middle sample, equal to a neighbor if duplicates
+	return sample[n], sample[n] == sample[n-1] || sample[n] == sample[n+1]
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -171,27 +256,62 @@ start:
 	}
 }
 
+// partEqB partitions slc into slc[:l] < pv, slc[l:h] = pv, slc[h:] > pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqB(slc [][]byte, pv string) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if sixb.BtoS(x) < pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv < sixb.BtoS(x) {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
 // new-goroutine partition
 //
 //go:nosplit
-func gPartOneB(ar [][]byte, pv string, ch chan int) {
-	ch <- partOneB(ar, pv)
+func gPartOneB(ar [][]byte, pv string, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneB(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
 //
 //go:nosplit
-func partConB(slc [][]byte, ch chan int) int {
+func partConB(slc [][]byte, sv *syncVar) int {
 
-	pv := pivotB(slc, nsConc-1) // median-of-n pivot
+	pv, _ := pivotB(slc, nsConc-1) // median-of-n pivot
 	mid := len(slc) >> 1
 	l, h := mid>>1, sixb.MeanI(mid, len(slc))
 
-	go gPartOneB(slc[l:h:h], pv, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneB(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneB(slc[l:h:h], pv)
+	}
 
 	r := partTwoB(slc, l, h, pv) // left/right quarter ranges
 
-	k := l + <-ch // convert returned index to slc
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
 
 	// only one gap is possible
 	if r < mid {
@@ -212,9 +332,16 @@ func partConB(slc [][]byte, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenInsFC < len(ar) <= MaxLenRecFC, recursive
-func shortB(ar [][]byte) {
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortB(ar [][]byte, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapB(ar)
+		return
+	}
 	first, step, last := minMaxSample(uint(len(ar)), 3)
 	f, pv, l := sixb.BtoS(ar[first]), sixb.BtoS(ar[first+step]), sixb.BtoS(ar[last])
 
@@ -239,15 +366,16 @@ start:
 		aq = ar[k:]
 		ar = ar[:k:k]
 	}
+	sv.partStat(len(aq), len(ar), depth)
 
-	if len(aq) > MaxLenInsFC {
-		shortB(aq) // recurse on the shorter range
+	if len(aq) > sv.ins {
+		shortB(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 isort:
 	insertionB(aq) // at least one insertion range
 
-	if len(ar) > MaxLenInsFC {
+	if len(ar) > sv.ins {
 		goto start
 	}
 	if &ar[0] != &aq[0] {
@@ -259,80 +387,126 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLongB(ar [][]byte, sv *syncVar) {
-	longB(ar, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLongB(ar [][]byte, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longB(ar, depth, sv)
 }
 
-// long range sort function, assumes len(ar) > MaxLenRecFC, recursive
-func longB(ar [][]byte, sv *syncVar) {
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longB(ar [][]byte, depth int, sv *syncVar) {
+	if runB(ar) { // presorted?
+		return
+	}
 start:
-	pv := pivotB(ar, nsLong-1) // median-of-n pivot
-	k := partOneB(ar, pv)
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapB(ar)
+		return
+	}
+	pv, dup := pivotB(ar, nsLong-1) // median-of-n pivot
 	var aq [][]byte
 
-	if k < len(ar)-k {
-		aq = ar[:k:k]
-		ar = ar[k:] // ar is the longer range
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqB(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortB(aq, depth, sv)
+			} else {
+				insertionB(aq)
+			}
+			if len(ar) > sv.ins {
+				shortB(ar, depth, sv)
+			} else {
+				insertionB(ar)
+			}
+			return
+		}
 	} else {
-		aq = ar[k:]
-		ar = ar[:k:k]
+		k := partOneB(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if len(aq) <= MaxLenRecFC { // at least one not-long range?
+	if len(aq) <= sv.rec { // at least one not-long range?
 
-		if len(aq) > MaxLenInsFC {
-			shortB(aq)
+		if len(aq) > sv.ins {
+			shortB(aq, depth, sv)
 		} else {
 			insertionB(aq)
 		}
 
-		if len(ar) > MaxLenRecFC { // two not-long ranges?
+		if len(ar) > sv.rec { // two not-long ranges?
 			goto start
 		}
-		shortB(ar) // we know len(ar) > MaxLenInsFC
+		shortB(ar, depth, sv) // we know len(ar) > sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		longB(aq, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longB(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLongB(ar, sv)
+	go gLongB(ar, depth, sv)
 	ar = aq
 	goto start
 }
 
 // sortB concurrently sorts ar in ascending lexicographic order.
-func sortB(ar [][]byte) {
+func sortB(ar [][]byte, sv *syncVar) {
 
-	if len(ar) < 2*(MaxLenRecFC+1) || MaxGor <= 1 {
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
 
-		if len(ar) > MaxLenRecFC { // single-goroutine sorting
-			longB(ar, nil)
-		} else if len(ar) > MaxLenInsFC {
-			shortB(ar)
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longB(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortB(ar, depth, sv)
 		} else {
 			insertionB(ar)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runB(ar) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	for {
 		// concurrent dual partitioning with done
-		k := partConB(ar, sv.done)
+		k := partConB(ar, sv)
+		depth--
 		var aq [][]byte
 
 		if k < len(ar)-k {
@@ -342,28 +516,155 @@ func sortB(ar [][]byte) {
 			aq = ar[k:]
 			ar = ar[:k:k]
 		}
+		sv.partStat(len(aq), len(ar), depth)
 
 		// handle shorter range
-		if len(aq) > MaxLenRecFC {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLongB(aq, &sv)
-
-		} else if len(aq) > MaxLenInsFC {
-			shortB(aq)
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongB(aq, depth, sv)
+			} else {
+				longB(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortB(aq, depth, sv)
 		} else {
 			insertionB(aq)
 		}
 
-		// longer range big enough? max goroutines?
-		if len(ar) < 2*(MaxLenRecFC+1) || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	longB(ar, &sv) // we know len(ar) > MaxLenRecFC
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longB(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
+}
+
+// selectB moves k-th smallest member of ar to ar[k], so that
+// ar[:k] ≤ ar[k] ≤ ar[k+1:]. It recurses only into the range that contains k.
+// Assumes 0 ≤ k < len(ar).
+func selectB(ar [][]byte, k int, sv *syncVar) {
+	depth := maxDepth(len(ar)) // partitioning budget
+	for len(ar) > sv.rec {
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapB(ar)
+			return
+		}
+
+		var m int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			m = partConB(ar, sv) // concurrent dual partitioning
+		} else {
+			pv, dup := pivotB(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // exclude members equal to pivot
+				l, h := partEqB(ar, pv)
+				sv.partStat(l, len(ar)-h, depth)
+				if k < l {
+					ar = ar[:l]
+				} else if k < h {
+					return // ar[k] = pivot
+				} else {
+					ar = ar[h:]
+					k -= h
+				}
+				continue
+			}
+			m = partOneB(ar, pv)
+		}
+
+		sv.partStat(m, len(ar)-m, depth)
+		if k < m {
+			ar = ar[:m]
+		} else {
+			ar = ar[m:]
+			k -= m
+		}
+	}
+
+	if len(ar) > sv.ins {
+		shortB(ar, depth, sv)
+	} else {
+		insertionB(ar)
+	}
+}
+
+// multiB moves ks[i]-th smallest member to ar[ks[i]-off] for each i, where ks
+// are ascending ranks and ar starts at rank off. It recurses only into ranges
+// that contain requested ranks. Assumes off ≤ ks[i] < off+len(ar).
+func multiB(ar [][]byte, ks []int, off, depth int, sv *syncVar) {
+	for len(ks) > 1 {
+		if len(ar) <= sv.rec {
+			if len(ar) > sv.ins {
+				shortB(ar, depth, sv)
+			} else {
+				insertionB(ar)
+			}
+			return
+		}
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapB(ar)
+			return
+		}
+
+		var l, h int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partConB(ar, sv) // concurrent dual partitioning
+			h = l
+		} else {
+			pv, dup := pivotB(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // members equal to pivot are in ar[l:h]
+				l, h = partEqB(ar, pv)
+			} else {
+				l = partOneB(ar, pv)
+				h = l
+			}
+		}
+
+		sv.partStat(l, len(ar)-h, depth)
+
+		// split ranks as per partitioning
+		i := 0
+		for i < len(ks) && ks[i]-off < l {
+			i++
+		}
+		j := i
+		for j < len(ks) && ks[j]-off < h {
+			j++
+		}
+		if i > 0 {
+			multiB(ar[:l], ks[:i], off, depth, sv)
+		}
+		ar, ks, off = ar[h:], ks[j:], off+h
+	}
+
+	if len(ks) > 0 {
+		selectB(ar, ks[0]-off, sv)
+	}
+}
 
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
+// partialB concurrently sorts k smallest members of ar to ar[:k].
+//
+//go:nosplit
+func partialB(ar [][]byte, k int, sv *syncVar) {
+	if k <= 0 {
+		return
+	}
+	if k < len(ar) {
+		selectB(ar, k, sv)
+		ar = ar[:k]
 	}
+	sortB(ar, sv)
 }
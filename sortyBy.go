@@ -0,0 +1,116 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+// byKey is a single key comparison of an Order
+type byKey struct {
+	cmp  func(i, k int, nan FloatOption) int // -1, 0, 1 for members i,k
+	nan  FloatOption
+	desc bool
+}
+
+// Order is an immutable list of key comparisons to build a correct [Lesswap] from,
+// first key being the most significant. Start one with [By](), for example:
+//
+//	lsw := sorty.By(func(i int) int64 { return rows[i].Time }).
+//		ThenBy(sorty.By(func(i int) string { return rows[i].Name }).Desc()).
+//		Lesswap(func(i, k int) { rows[i], rows[k] = rows[k], rows[i] })
+//
+//	sorty.Sort(len(rows), lsw)
+type Order struct {
+	keys []byKey
+}
+
+// By returns an ascending Order on key(i), which returns the key of member i of the
+// underlying collection. key() is called on every comparison, so it should be cheap,
+// use [SortByKey]() for expensive keys. Float NaN keys are handled as per [NaNoption]
+// at the time of this call, see [Order.NaN]().
+func By[K Ordered](key func(i int) K) Order {
+	cmp := func(i, k int, nan FloatOption) int {
+		x, y := key(i), key(k)
+		if x < y {
+			return -1
+		}
+		if y < x {
+			return 1
+		}
+		if x == y || nan == NaNignore {
+			return 0
+		}
+		// at least one NaN
+		if x == x {
+			return -int(nan) // y is NaN
+		}
+		if y == y {
+			return int(nan) // x is NaN
+		}
+		return 0
+	}
+	return Order{[]byKey{{cmp, NaNoption, false}}}
+}
+
+// with returns a copy of o whose keys are modified by f
+func (o Order) with(f func(k *byKey)) Order {
+	keys := make([]byKey, len(o.keys))
+	copy(keys, o.keys)
+	for i := range keys {
+		f(&keys[i])
+	}
+	return Order{keys}
+}
+
+// ThenBy returns a new Order that compares with o, and with next for members that
+// o considers equal.
+func (o Order) ThenBy(next Order) Order {
+	keys := make([]byKey, 0, len(o.keys)+len(next.keys))
+	keys = append(keys, o.keys...)
+	return Order{append(keys, next.keys...)}
+}
+
+// Desc returns the exact reverse of o, including its NaN placement.
+func (o Order) Desc() Order {
+	return o.with(func(k *byKey) { k.desc = !k.desc })
+}
+
+// NaN returns a new Order like o whose float keys handle NaNs as per nan, like
+// [NaNoption]. It has no effect on other keys.
+func (o Order) NaN(nan FloatOption) Order {
+	return o.with(func(k *byKey) { k.nan = nan })
+}
+
+// Less returns the strict comparison function of o, like less(i,k) of [ArgSort]().
+func (o Order) Less() func(i, k int) bool {
+	keys := o.with(func(*byKey) {}).keys
+	return func(i, k int) bool {
+		for c := range keys {
+			key := &keys[c]
+			if r := key.cmp(i, k, key.nan); r != 0 {
+				return r < 0 != key.desc
+			}
+		}
+		return false
+	}
+}
+
+// Lesswap returns a Lesswap that compares as per o and swaps members r,s of the
+// underlying collection with swap(r,s) as per [Lesswap] contract. It panics if o
+// has no keys or swap is nil.
+func (o Order) Lesswap(swap func(i, k int)) Lesswap {
+	if len(o.keys) == 0 || swap == nil {
+		panic("sorty: Order.Lesswap: empty order or nil swap")
+	}
+	less := o.Less()
+	return func(i, k, r, s int) bool {
+		if less(i, k) {
+			if r != s {
+				swap(r, s)
+			}
+			return true
+		}
+		return false
+	}
+}
@@ -0,0 +1,165 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"fmt"
+	"sync"
+)
+
+// max #samples for checking Lesswap contract
+const nsCheck = 32
+
+// checkLsw verifies lsw on up to nsCheck equidistant members, it leaves the
+// collection as it was if lsw honors the contract
+func checkLsw(n int, lsw Lesswap) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("sorty: lesswap panicked: %v", p)
+		}
+	}()
+	m := n
+	if m > nsCheck {
+		m = nsCheck
+	}
+	at := make([]int, m) // sample indices
+	for a := range at {
+		at[a] = a * n / m
+	}
+
+	less := make([]bool, m*m) // less[a*m+b] = less(at[a], at[b])
+	for a, i := range at {
+		for b, k := range at {
+			x := lsw(i, k, i, i) // 3rd=4th disables swap
+			if lsw(i, k, k, k) != x {
+				return fmt.Errorf("sorty: lesswap(%d,%d,r,r) results differ, "+
+					"it must not swap when r=s", i, k)
+			}
+			less[a*m+b] = x
+		}
+	}
+
+	for a, i := range at {
+		if less[a*m+a] {
+			return fmt.Errorf("sorty: less(%d,%d) is true, it must be strict", i, i)
+		}
+		for b, k := range at {
+			if less[a*m+b] && less[b*m+a] {
+				return fmt.Errorf("sorty: less(%d,%d) & less(%[2]d,%[1]d) are true", i, k)
+			}
+			for c, h := range at {
+				if less[a*m+b] && less[b*m+c] && !less[a*m+c] {
+					return fmt.Errorf("sorty: less(%d,%d) & less(%d,%d) are true, "+
+						"less(%[1]d,%[4]d) is false", i, k, k, h)
+				}
+				eab := !less[a*m+b] && !less[b*m+a]
+				ebc := !less[b*m+c] && !less[c*m+b]
+				if eab && ebc && (less[a*m+c] || less[c*m+a]) {
+					return fmt.Errorf("sorty: members %d,%d and %d,%d are equivalent, "+
+						"%[1]d,%[4]d are not", i, k, k, h)
+				}
+			}
+		}
+	}
+
+	// results must not change after calls with 3rd=4th
+	for a, i := range at {
+		for b, k := range at {
+			if lsw(i, k, i, i) != less[a*m+b] {
+				return fmt.Errorf("sorty: less(%d,%d) changed, lesswap must not swap "+
+					"when r=s", i, k)
+			}
+		}
+	}
+
+	// swap must exchange r,s
+	for a, i := range at {
+		for b, k := range at {
+			if !less[a*m+b] {
+				continue
+			}
+			lsw(i, k, i, k) // swap
+			if lsw(i, k, i, i) || !lsw(k, i, k, k) {
+				return fmt.Errorf("sorty: lesswap(%d,%d,%[1]d,%[2]d) did not swap "+
+					"members %[1]d,%[2]d", i, k)
+			}
+			lsw(k, i, i, k) // swap back
+			if !lsw(i, k, i, i) {
+				return fmt.Errorf("sorty: lesswap(%d,%d,%[2]d,%[1]d) did not swap "+
+					"members %[2]d,%[1]d", k, i)
+			}
+			return nil // one exchange is enough
+		}
+	}
+	return nil
+}
+
+// CheckLesswap checks lsw on sampled members of underlying collection of length n
+// and returns a descriptive error if lsw:
+//   - is not a strict weak ordering: less(i,i), less(i,k) & less(k,i), or
+//     non-transitive less or equivalence on some triple
+//   - swaps members when its 3rd & 4th arguments are equal
+//   - does not exchange members r,s when less(i,k) is true
+//   - panics, for example due to out-of-range indices
+//
+// A nil result does not prove that lsw is correct.
+func CheckLesswap(n int, lsw Lesswap) error {
+	return checkLsw(n, lsw)
+}
+
+// checkedSort sorts with a guarded lsw that stops sorting at the first violation
+func checkedSort(n int, lsw Lesswap, sv *syncVar) error {
+	if err := checkLsw(n, lsw); err != nil {
+		return err
+	}
+
+	var (
+		err  error
+		once sync.Once
+		stop = make(chan struct{})
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			close(stop)
+		})
+	}
+	sv.stop = stop
+	cnt := sv.count(lsw) // statistics, if collected
+
+	sortLw(n, func(i, k, r, s int) (ok bool) {
+		if uint(i) >= uint(n) || uint(k) >= uint(n) || uint(r) >= uint(n) || uint(s) >= uint(n) {
+			fail(fmt.Errorf("sorty: lesswap(%d,%d,%d,%d) called with out-of-range "+
+				"index, n=%d", i, k, r, s, n))
+			return false
+		}
+		defer func() {
+			if p := recover(); p != nil {
+				fail(fmt.Errorf("sorty: lesswap(%d,%d,%d,%d) panicked: %v", i, k, r, s, p))
+				ok = false
+			}
+		}()
+		return cnt(i, k, r, s)
+	}, sv)
+
+	if err != nil { // all goroutines are done
+		return err
+	}
+	if i := IsSorted(n, lsw); i > 0 {
+		return fmt.Errorf("sorty: collection is not sorted at %d after sorting, "+
+			"lesswap is inconsistent", i)
+	}
+	return nil
+}
+
+// CheckedSort is a debugging aid for [Sort](). It first runs [CheckLesswap]() and
+// returns its error without sorting. Otherwise it sorts with a guarded lsw that
+// recovers panics and stops sorting at the first violation, and finally verifies
+// the result with [IsSorted](). It is slower than [Sort]().
+func CheckedSort(n int, lsw Lesswap) error {
+	return checkedSort(n, lsw, std.newVar(true))
+}
@@ -0,0 +1,271 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/jfcg/sixb"
+)
+
+// NullOrder determines where nulls of a [Column] go in sorted rows.
+type NullOrder uint8
+
+// Possible values for NullOrder
+const (
+	// NullsLast puts nulls after all values, for ascending & descending columns
+	NullsLast NullOrder = iota
+
+	// NullsFirst puts nulls before all values, for ascending & descending columns
+	NullsFirst
+)
+
+// Column is a sort key for [SortColumns]() and [ColumnPerm]().
+type Column struct {
+	// Data is the column slice, its type can be as in [SortSlice]().
+	Data any
+
+	// Null optionally marks null rows with true, it is nil or of same length as
+	// Data. NaNs of float columns are also nulls. Nulls are equal to each other.
+	Null []bool
+
+	// Desc sorts column in descending order.
+	Desc bool
+
+	// Nulls is where nulls go, independent of Desc.
+	Nulls NullOrder
+}
+
+// tie is a range [l,h) of the row permutation with rows equal on sorted columns
+type tie struct{ l, h int }
+
+// addTie appends [l,h) to ties if it has multiple rows, inlined
+func addTie(ties []tie, l, h int) []tie {
+	if h-l > 1 {
+		ties = append(ties, tie{l, h})
+	}
+	return ties
+}
+
+// colSort is a compiled Column, it refines rows idx at offset off of the row
+// permutation, appends ranges of equal rows to ties and returns them, see sortCol()
+type colSort func(idx []int, off int, ties []tie, srt *Sorter) []tie
+
+// sortCol stably sorts rows idx in ascending order by col natively, via sorting
+// (key, row) pairs. Null rows go to the start (first) or end of idx. Values are in
+// descending order if desc, equal values keep ascending row order. It appends
+// ranges of equal rows at offset off to ties and returns them.
+func sortCol[T argKey](col []T, null func(i int) bool, desc, first bool, k Kind,
+	idx []int, off int, ties []tie, srt *Sorter) []tie {
+
+	vs := idx // value rows
+	if null != nil {
+		var ns []int // null rows
+		m := 0
+		for _, i := range idx {
+			if null(i) {
+				ns = append(ns, i)
+			} else {
+				idx[m] = i
+				m++
+			}
+		}
+		if first {
+			copy(idx[len(ns):], idx[:m])
+			copy(idx, ns)
+			vs = idx[len(ns):]
+			ties = addTie(ties, off, off+len(ns))
+			off += len(ns)
+		} else {
+			copy(idx[m:], ns)
+			vs = idx[:m]
+			ties = addTie(ties, off+m, off+len(idx))
+		}
+	}
+	if len(vs) < 2 {
+		return ties
+	}
+
+	ps := make([]pair[T], len(vs))
+	for j, i := range vs {
+		ps[j] = pair[T]{col[i], i}
+	}
+	sortP(ps, srt.kindVar(k)) // concurrent sorting ends its per-call variables
+
+	if desc { // reverse, then reverse back each run of equal values below
+		for l, h := 0, len(ps)-1; l < h; l, h = l+1, h-1 {
+			ps[l], ps[h] = ps[h], ps[l]
+		}
+	}
+	for l := 0; l < len(ps); {
+		h := l + 1
+		for h < len(ps) && ps[h].key == ps[l].key {
+			h++
+		}
+		if desc {
+			for a, b := l, h-1; a < b; a, b = a+1, b-1 {
+				ps[a], ps[b] = ps[b], ps[a]
+			}
+		}
+		ties = addTie(ties, off+l, off+h)
+		l = h
+	}
+	for j := range ps {
+		vs[j] = ps[j].idx
+	}
+	return ties
+}
+
+// colOf compiles column c with keys col and null check null()
+func colOf[T argKey](col []T, null func(i int) bool, c *Column, k Kind) colSort {
+	desc, first := c.Desc, c.Nulls == NullsFirst
+	return func(idx []int, off int, ties []tie, srt *Sorter) []tie {
+		return sortCol(col, null, desc, first, k, idx, off, ties, srt)
+	}
+}
+
+// nullOf returns null check function of col rows with optional mask, nil if col
+// has no nulls. NaN checks are only for float columns.
+func nullOf[T argKey](col []T, mask []bool, float bool) func(i int) bool {
+	if !float {
+		if mask == nil {
+			return nil
+		}
+		return func(i int) bool { return mask[i] }
+	}
+	if mask == nil {
+		return func(i int) bool { x := col[i]; return x != x }
+	}
+	return func(i int) bool { x := col[i]; return x != x || mask[i] }
+}
+
+// compile converts columns to native sorters, returns nil for invalid input
+func compile(cols []Column) ([]colSort, int) {
+	if len(cols) == 0 {
+		return nil, 0
+	}
+	cs := make([]colSort, len(cols))
+	n := -1
+	for i := range cols {
+		c := &cols[i]
+		slc, kind := extractSK(c.Data)
+		if n < 0 {
+			n = slc.Len
+		}
+		if slc.Len != n || c.Null != nil && len(c.Null) != n {
+			return nil, 0
+		}
+		k := sliceKind(kind)
+
+		switch kind {
+		case reflect.Int32:
+			col := *(*[]int32)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		case reflect.Int64:
+			col := *(*[]int64)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		case reflect.Uint32:
+			col := *(*[]uint32)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		case reflect.Uint64:
+			col := *(*[]uint64)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		case reflect.Float32:
+			col := *(*[]float32)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, true), c, k)
+		case reflect.Float64:
+			col := *(*[]float64)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, true), c, k)
+		case reflect.String:
+			col := *(*[]string)(unsafe.Pointer(&slc))
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		case sliceBias + reflect.Uint8: // [][]byte, compared as strings
+			b := *(*[][]byte)(unsafe.Pointer(&slc))
+			col := make([]string, len(b))
+			for r, x := range b {
+				col[r] = sixb.BtoS(x)
+			}
+			cs[i] = colOf(col, nullOf(col, c.Null, false), c, k)
+		default:
+			return nil, 0
+		}
+	}
+	return cs, n
+}
+
+// columnPerm returns the row permutation that sorts cols, or nil for invalid input.
+// Rows are sorted by the first column, then each range of rows equal so far is
+// refined by the next column.
+func columnPerm(cols []Column, srt *Sorter) []int {
+	cs, n := compile(cols)
+	if cs == nil {
+		return nil
+	}
+	perm := identity(n)
+	ties := addTie(nil, 0, n)
+	for _, c := range cs {
+		var next []tie
+		for _, r := range ties {
+			next = c(perm[r.l:r.h], r.l, next, srt)
+		}
+		ties = next
+	}
+	return perm
+}
+
+// ColumnPerm concurrently computes and returns the permutation p that sorts the rows
+// of a column-wise table by cols, first column being the most significant. So row
+// p[0] is the first in sorted order. Columns are not modified. Each column is sorted
+// in ascending or descending order with nulls first or last as per its [Column]
+// spec. [NaNoption] is not used. Keys are compared natively: rows are sorted by the
+// first column like [ArgSortSlice](), then ranges of equal rows are sorted by the next
+// column and so on. Sorting is stable: equal rows are in ascending index order in p.
+// It panics if cols is empty, any column type is not as in [SortSlice]() or lengths
+// of columns & null masks differ.
+func ColumnPerm(cols ...Column) []int {
+	if p := columnPerm(cols, std); p != nil {
+		return p
+	}
+	panic("sorty: ColumnPerm: invalid input")
+}
+
+// sortColumns sorts cols & others via their row permutation
+func sortColumns(cols []Column, others []any, srt *Sorter) bool {
+	p := columnPerm(cols, srt)
+	if p == nil {
+		return false
+	}
+	for _, o := range others {
+		if v := reflect.ValueOf(o); v.Kind() != reflect.Slice || v.Len() != len(p) {
+			return false
+		}
+	}
+
+	sv := srt.newVar(false)
+	for _, c := range cols {
+		applyAny(c.Data, p, sv)
+		if c.Null != nil {
+			applyOf(c.Null, p, sv)
+		}
+	}
+	for _, o := range others {
+		applyAny(o, p, sv)
+	}
+	return true
+}
+
+// SortColumns concurrently sorts rows of a column-wise table in-place: it computes
+// [ColumnPerm](cols...) and applies it to Data & Null slices of cols and to each of
+// others, which are the rest of the columns. Each slice must be given only once.
+// It panics for invalid input as per [ColumnPerm](), or if any of others is not
+// a slice of same length.
+func SortColumns(cols []Column, others ...any) {
+	if !sortColumns(cols, others, std) {
+		panic("sorty: SortColumns: invalid input")
+	}
+}
@@ -0,0 +1,525 @@
+/*	Copyright (c) 2019-present, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import "github.com/jfcg/sixb"
+
+// isSortedDescB returns 0 if ar is sorted in descending lexicographic
+// order, otherwise it returns i > 0 with sixb.BtoS(ar[i]) > sixb.BtoS(ar[i-1]), inlined
+func isSortedDescB(ar [][]byte) int {
+	for i := len(ar) - 1; i > 0; i-- {
+		if sixb.BtoS(ar[i]) > sixb.BtoS(ar[i-1]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// insertion sort, inlined
+func insertionDescB(slc [][]byte) {
+	for h := 1; h < len(slc); h++ {
+		l, val := h, slc[h]
+		var pre []byte
+		goto start
+	loop:
+		slc[l] = pre
+		l--
+		if l == 0 {
+			goto last
+		}
+	start:
+		pre = slc[l-1]
+		if sixb.BtoS(val) > sixb.BtoS(pre) {
+			goto loop
+		}
+		if l == h {
+			continue
+		}
+	last:
+		slc[l] = val
+	}
+}
+
+// heapDescB sorts slc in descending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapDescB(slc [][]byte) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftDescB(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftDescB(slc, 0, n)
+	}
+}
+
+// siftDescB moves slc[root] down in heap slc[:n], inlined
+func siftDescB(slc [][]byte, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; sixb.BtoS(top) > sixb.BtoS(nxt) {
+				top = nxt
+				c++
+			}
+		}
+		if sixb.BtoS(val) <= sixb.BtoS(top) {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runDescB tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runDescB(slc [][]byte) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if sixb.BtoS(slc[i]) > sixb.BtoS(slc[i-step]) {
+			fwd = false
+		} else if sixb.BtoS(slc[i-step]) > sixb.BtoS(slc[i]) {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if sixb.BtoS(slc[i-1]) > sixb.BtoS(slc[i]) {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if sixb.BtoS(val) <= sixb.BtoS(slc[h-1]) {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && sixb.BtoS(val) > sixb.BtoS(slc[l-1]); l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
+// partition slc, returns k with slc[:k] ≥ pivot ≥ slc[k:]
+// swap: slc[h] > pv ≥ slc[l]
+// swap: slc[h] ≥ pv > slc[l]
+// next: slc[l] ≥ pv ≥ slc[h]
+//
+//go:nosplit
+func partOneDescB(slc [][]byte, pv string) int {
+	l, h := 0, len(slc)-1
+	goto start
+second:
+	for {
+		h--
+		if h <= l {
+			return l
+		}
+		if sixb.BtoS(slc[h]) >= pv {
+			break
+		}
+	}
+swap:
+	slc[l], slc[h] = slc[h], slc[l]
+next:
+	l++
+	h--
+start:
+	if h <= l {
+		goto last
+	}
+
+	if pv >= sixb.BtoS(slc[h]) { // avoid unnecessary comparisons
+		if pv > sixb.BtoS(slc[l]) { // extend ranges in balance
+			goto second
+		}
+		goto next
+	}
+	for {
+		if pv >= sixb.BtoS(slc[l]) {
+			goto swap
+		}
+		l++
+		if h <= l {
+			return l + 1
+		}
+	}
+last:
+	if l == h && sixb.BtoS(slc[h]) > pv { // classify mid element
+		l++
+	}
+	return l
+}
+
+// swaps elements to get slc[:l] ≥ pivot ≥ slc[h:]
+// Gap (l,h) expands until one of the intervals is fully consumed.
+// swap: slc[h] > pv ≥ slc[l]
+// swap: slc[h] ≥ pv > slc[l]
+// next: slc[l] ≥ pv ≥ slc[h]
+//
+//go:nosplit
+func partTwoDescB(slc [][]byte, l, h int, pv string) int {
+	l--
+	if h <= l {
+		return -1 // will not run
+	}
+	goto start
+second:
+	for {
+		h++
+		if h >= len(slc) {
+			return l
+		}
+		if sixb.BtoS(slc[h]) >= pv {
+			break
+		}
+	}
+swap:
+	slc[l], slc[h] = slc[h], slc[l]
+next:
+	l--
+	h++
+start:
+	if l < 0 {
+		return h
+	}
+	if h >= len(slc) {
+		return l
+	}
+
+	if pv >= sixb.BtoS(slc[h]) { // avoid unnecessary comparisons
+		if pv > sixb.BtoS(slc[l]) { // extend ranges in balance
+			goto second
+		}
+		goto next
+	}
+	for {
+		if pv >= sixb.BtoS(slc[l]) {
+			goto swap
+		}
+		l--
+		if l < 0 {
+			return h
+		}
+	}
+}
+
+// partEqDescB partitions slc into slc[:l] > pv, slc[l:h] = pv, slc[h:] < pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqDescB(slc [][]byte, pv string) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if sixb.BtoS(x) > pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv > sixb.BtoS(x) {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
+// new-goroutine partition
+//
+//go:nosplit
+func gPartOneDescB(ar [][]byte, pv string, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneDescB(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
+}
+
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≥ pivot ≥ slc[k:]
+//
+//go:nosplit
+func partConDescB(slc [][]byte, sv *syncVar) int {
+
+	pv, _ := pivotB(slc, nsConc-1) // median-of-n pivot
+	mid := len(slc) >> 1
+	l, h := mid>>1, sixb.MeanI(mid, len(slc))
+
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneDescB(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneDescB(slc[l:h:h], pv)
+	}
+
+	r := partTwoDescB(slc, l, h, pv) // left/right quarter ranges
+
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
+
+	// only one gap is possible
+	if r < mid {
+		for ; 0 <= r; r-- { // gap left in low range?
+			if pv > sixb.BtoS(slc[r]) {
+				k--
+				slc[r], slc[k] = slc[k], slc[r]
+			}
+		}
+	} else {
+		for ; r < len(slc); r++ { // gap left in high range?
+			if sixb.BtoS(slc[r]) > pv {
+				slc[r], slc[k] = slc[k], slc[r]
+				k++
+			}
+		}
+	}
+	return k
+}
+
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortDescB(ar [][]byte, depth int, sv *syncVar) {
+start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapDescB(ar)
+		return
+	}
+	first, step, last := minMaxSample(uint(len(ar)), 3)
+	f, pv, l := sixb.BtoS(ar[first]), sixb.BtoS(ar[first+step]), sixb.BtoS(ar[last])
+
+	if pv < f {
+		pv, f = f, pv
+	}
+	if l < pv {
+		if l < f {
+			pv = f
+		} else {
+			pv = l // median-of-3 pivot
+		}
+	}
+
+	k := partOneDescB(ar, pv)
+	var aq [][]byte
+
+	if k < len(ar)-k {
+		aq = ar[:k:k]
+		ar = ar[k:] // ar is the longer range
+	} else {
+		aq = ar[k:]
+		ar = ar[:k:k]
+	}
+	sv.partStat(len(aq), len(ar), depth)
+
+	if len(aq) > sv.ins {
+		shortDescB(aq, depth, sv) // recurse on the shorter range
+		goto start
+	}
+isort:
+	insertionDescB(aq) // at least one insertion range
+
+	if len(ar) > sv.ins {
+		goto start
+	}
+	if &ar[0] != &aq[0] {
+		aq = ar
+		goto isort // two insertion ranges
+	}
+}
+
+// new-goroutine sort function
+//
+//go:nosplit
+func gLongDescB(ar [][]byte, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longDescB(ar, depth, sv)
+}
+
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longDescB(ar [][]byte, depth int, sv *syncVar) {
+	if runDescB(ar) { // presorted?
+		return
+	}
+start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapDescB(ar)
+		return
+	}
+	pv, dup := pivotB(ar, nsLong-1) // median-of-n pivot
+	var aq [][]byte
+
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqDescB(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortDescB(aq, depth, sv)
+			} else {
+				insertionDescB(aq)
+			}
+			if len(ar) > sv.ins {
+				shortDescB(ar, depth, sv)
+			} else {
+				insertionDescB(ar)
+			}
+			return
+		}
+	} else {
+		k := partOneDescB(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
+	}
+
+	// branches below are optimal for fewer total jumps
+	if len(aq) <= sv.rec { // at least one not-long range?
+
+		if len(aq) > sv.ins {
+			shortDescB(aq, depth, sv)
+		} else {
+			insertionDescB(aq)
+		}
+
+		if len(ar) > sv.rec { // two not-long ranges?
+			goto start
+		}
+		shortDescB(ar, depth, sv) // we know len(ar) > sv.ins
+		return
+	}
+
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longDescB(aq, depth, sv) // recurse on the shorter range
+		goto start
+	}
+
+	// new-goroutine sort on the longer range only when
+	// both ranges are big and max goroutines is not exceeded
+	go gLongDescB(ar, depth, sv)
+	ar = aq
+	goto start
+}
+
+// sortDescB concurrently sorts ar in descending lexicographic order.
+func sortDescB(ar [][]byte, sv *syncVar) {
+
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
+
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longDescB(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortDescB(ar, depth, sv)
+		} else {
+			insertionDescB(ar)
+		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runDescB(ar) { // presorted?
+		return
+	}
+
+	// create channel only when concurrent partitioning & sorting
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
+	for {
+		// concurrent dual partitioning with done
+		k := partConDescB(ar, sv)
+		depth--
+		var aq [][]byte
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		// handle shorter range
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongDescB(aq, depth, sv)
+			} else {
+				longDescB(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortDescB(aq, depth, sv)
+		} else {
+			insertionDescB(aq)
+		}
+
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
+			break
+		}
+		// dual partition longer range
+	}
+
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longDescB(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
+}
@@ -6,23 +6,19 @@
 
 package sorty
 
-import (
-	"sync/atomic"
-
-	"github.com/jfcg/sixb"
-)
+import "github.com/jfcg/sixb"
 
 // isSortedF8 returns 0 if slc is sorted in ascending order, otherwise it returns i > 0
-// with slc[i] < slc[i-1] or either one is a NaN. NaNoption is taken into account.
-func isSortedF8(slc []float64) int {
+// with slc[i] < slc[i-1] or either one is a NaN. NaNs are handled as per nan.
+func isSortedF8(slc []float64, nan FloatOption) int {
 	l, h := 0, len(slc)-1
-	if NaNoption == NaNlarge { // ignore NaNs at the end
+	if nan == NaNlarge { // ignore NaNs at the end
 		for ; l <= h; h-- {
 			if x := slc[h]; x == x {
 				break
 			}
 		}
-	} else if NaNoption == NaNsmall { // ignore NaNs at the start
+	} else if nan == NaNsmall { // ignore NaNs at the start
 		for ; l <= h; l++ {
 			if x := slc[l]; x == x {
 				break
@@ -63,12 +59,100 @@ func insertionF8(slc []float64) {
 	}
 }
 
+// heapF8 sorts slc in ascending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapF8(slc []float64) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftF8(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftF8(slc, 0, n)
+	}
+}
+
+// siftF8 moves slc[root] down in heap slc[:n], inlined
+func siftF8(slc []float64, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; top < nxt {
+				top = nxt
+				c++
+			}
+		}
+		if val >= top {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runF8 tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runF8(slc []float64) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if slc[i] < slc[i-step] {
+			fwd = false
+		} else if slc[i-step] < slc[i] {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if slc[i-1] < slc[i] {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if val >= slc[h-1] {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && val < slc[l-1]; l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
 // pivotF8 selects n equidistant samples from slc that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning.
+// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning
+// and whether samples show duplicates of it.
 //
 //go:nosplit
-func pivotF8(slc []float64, n uint) float64 {
+func pivotF8(slc []float64, n uint) (float64, bool) {
 
 	first, step, _ := minMaxSample(uint(len(slc)), n)
 
@@ -79,7 +163,8 @@ func pivotF8(slc []float64, n uint) float64 {
 	}
 	insertionF8(sample[:n]) // sort n samples
 
-	return sample[n>>1] // return middle sample
+	n >>= 1 // return middle sample, equal to a neighbor if duplicates
+	return sample[n], sample[n] == sample[n-1] || sample[n] == sample[n+1]
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -186,27 +271,62 @@ start:
 	}
 }
 
+// partEqF8 partitions slc into slc[:l] < pv, slc[l:h] = pv, slc[h:] > pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqF8(slc []float64, pv float64) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if x < pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv < x {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
 // new-goroutine partition
 //
 //go:nosplit
-func gPartOneF8(ar []float64, pv float64, ch chan int) {
-	ch <- partOneF8(ar, pv)
+func gPartOneF8(ar []float64, pv float64, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneF8(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
 //
 //go:nosplit
-func partConF8(slc []float64, ch chan int) int {
+func partConF8(slc []float64, sv *syncVar) int {
 
-	pv := pivotF8(slc, nsConc-1) // median-of-n pivot
+	pv, _ := pivotF8(slc, nsConc-1) // median-of-n pivot
 	mid := len(slc) >> 1
 	l, h := mid>>1, sixb.MeanI(mid, len(slc))
 
-	go gPartOneF8(slc[l:h:h], pv, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneF8(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneF8(slc[l:h:h], pv)
+	}
 
 	r := partTwoF8(slc, l, h, pv) // left/right quarter ranges
 
-	k := l + <-ch // convert returned index to slc
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
 
 	// only one gap is possible
 	if r < mid {
@@ -227,9 +347,16 @@ func partConF8(slc []float64, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenIns < len(ar) <= MaxLenRec, recursive
-func shortF8(ar []float64) {
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortF8(ar []float64, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapF8(ar)
+		return
+	}
 	first, step, last := minMaxSample(uint(len(ar)), 3)
 	f, pv, l := ar[first], ar[first+step], ar[last]
 
@@ -254,15 +381,16 @@ start:
 		aq = ar[k:]
 		ar = ar[:k:k]
 	}
+	sv.partStat(len(aq), len(ar), depth)
 
-	if len(aq) > MaxLenIns {
-		shortF8(aq) // recurse on the shorter range
+	if len(aq) > sv.ins {
+		shortF8(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 isort:
 	insertionF8(aq) // at least one insertion range
 
-	if len(ar) > MaxLenIns {
+	if len(ar) > sv.ins {
 		goto start
 	}
 	if &ar[0] != &aq[0] {
@@ -274,55 +402,88 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLongF8(ar []float64, sv *syncVar) {
-	longF8(ar, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLongF8(ar []float64, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longF8(ar, depth, sv)
 }
 
-// long range sort function, assumes len(ar) > MaxLenRec, recursive
-func longF8(ar []float64, sv *syncVar) {
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longF8(ar []float64, depth int, sv *syncVar) {
+	if runF8(ar) { // presorted?
+		return
+	}
 start:
-	pv := pivotF8(ar, nsLong-1) // median-of-n pivot
-	k := partOneF8(ar, pv)
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapF8(ar)
+		return
+	}
+	pv, dup := pivotF8(ar, nsLong-1) // median-of-n pivot
 	var aq []float64
 
-	if k < len(ar)-k {
-		aq = ar[:k:k]
-		ar = ar[k:] // ar is the longer range
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqF8(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortF8(aq, depth, sv)
+			} else {
+				insertionF8(aq)
+			}
+			if len(ar) > sv.ins {
+				shortF8(ar, depth, sv)
+			} else {
+				insertionF8(ar)
+			}
+			return
+		}
 	} else {
-		aq = ar[k:]
-		ar = ar[:k:k]
+		k := partOneF8(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if len(aq) <= MaxLenRec { // at least one not-long range?
+	if len(aq) <= sv.rec { // at least one not-long range?
 
-		if len(aq) > MaxLenIns {
-			shortF8(aq)
+		if len(aq) > sv.ins {
+			shortF8(aq, depth, sv)
 		} else {
 			insertionF8(aq)
 		}
 
-		if len(ar) > MaxLenRec { // two not-long ranges?
+		if len(ar) > sv.rec { // two not-long ranges?
 			goto start
 		}
-		shortF8(ar) // we know len(ar) > MaxLenIns
+		shortF8(ar, depth, sv) // we know len(ar) > sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		longF8(aq, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longF8(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLongF8(ar, sv)
+	go gLongF8(ar, depth, sv)
 	ar = aq
 	goto start
 }
@@ -330,9 +491,9 @@ start:
 // sortF8 concurrently sorts ar in ascending order.
 //
 //go:nosplit
-func sortF8(ar []float64) {
+func sortF8(ar []float64, sv *syncVar) {
 	l, h := 0, len(ar)-1
-	if NaNoption == NaNlarge { // move NaNs to the end
+	if sv.nan == NaNlarge { // move NaNs to the end
 		for l <= h {
 			x := ar[h]
 			if x != x {
@@ -347,7 +508,7 @@ func sortF8(ar []float64) {
 			l++
 		}
 		ar = ar[:h+1]
-	} else if NaNoption == NaNsmall { // move NaNs to the start
+	} else if sv.nan == NaNsmall { // move NaNs to the start
 		for l <= h {
 			y := ar[l]
 			if y != y {
@@ -364,24 +525,37 @@ func sortF8(ar []float64) {
 		ar = ar[l:]
 	}
 
-	if len(ar) < 2*(MaxLenRec+1) || MaxGor <= 1 {
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
 
-		if len(ar) > MaxLenRec { // single-goroutine sorting
-			longF8(ar, nil)
-		} else if len(ar) > MaxLenIns {
-			shortF8(ar)
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longF8(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortF8(ar, depth, sv)
 		} else {
 			insertionF8(ar)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runF8(ar) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	for {
 		// concurrent dual partitioning with done
-		k := partConF8(ar, sv.done)
+		k := partConF8(ar, sv)
+		depth--
 		var aq []float64
 
 		if k < len(ar)-k {
@@ -391,28 +565,155 @@ func sortF8(ar []float64) {
 			aq = ar[k:]
 			ar = ar[:k:k]
 		}
+		sv.partStat(len(aq), len(ar), depth)
 
 		// handle shorter range
-		if len(aq) > MaxLenRec {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLongF8(aq, &sv)
-
-		} else if len(aq) > MaxLenIns {
-			shortF8(aq)
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongF8(aq, depth, sv)
+			} else {
+				longF8(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortF8(aq, depth, sv)
 		} else {
 			insertionF8(aq)
 		}
 
-		// longer range big enough? max goroutines?
-		if len(ar) < 2*(MaxLenRec+1) || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	longF8(ar, &sv) // we know len(ar) > MaxLenRec
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longF8(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
+}
+
+// selectF8 moves k-th smallest member of ar to ar[k], so that
+// ar[:k] ≤ ar[k] ≤ ar[k+1:]. It recurses only into the range that contains k.
+// Assumes 0 ≤ k < len(ar).
+func selectF8(ar []float64, k int, sv *syncVar) {
+	depth := maxDepth(len(ar)) // partitioning budget
+	for len(ar) > sv.rec {
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapF8(ar)
+			return
+		}
 
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
+		var m int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			m = partConF8(ar, sv) // concurrent dual partitioning
+		} else {
+			pv, dup := pivotF8(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // exclude members equal to pivot
+				l, h := partEqF8(ar, pv)
+				sv.partStat(l, len(ar)-h, depth)
+				if k < l {
+					ar = ar[:l]
+				} else if k < h {
+					return // ar[k] = pivot
+				} else {
+					ar = ar[h:]
+					k -= h
+				}
+				continue
+			}
+			m = partOneF8(ar, pv)
+		}
+
+		sv.partStat(m, len(ar)-m, depth)
+		if k < m {
+			ar = ar[:m]
+		} else {
+			ar = ar[m:]
+			k -= m
+		}
+	}
+
+	if len(ar) > sv.ins {
+		shortF8(ar, depth, sv)
+	} else {
+		insertionF8(ar)
+	}
+}
+
+// multiF8 moves ks[i]-th smallest member to ar[ks[i]-off] for each i, where ks
+// are ascending ranks and ar starts at rank off. It recurses only into ranges
+// that contain requested ranks. Assumes off ≤ ks[i] < off+len(ar).
+func multiF8(ar []float64, ks []int, off, depth int, sv *syncVar) {
+	for len(ks) > 1 {
+		if len(ar) <= sv.rec {
+			if len(ar) > sv.ins {
+				shortF8(ar, depth, sv)
+			} else {
+				insertionF8(ar)
+			}
+			return
+		}
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapF8(ar)
+			return
+		}
+
+		var l, h int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partConF8(ar, sv) // concurrent dual partitioning
+			h = l
+		} else {
+			pv, dup := pivotF8(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // members equal to pivot are in ar[l:h]
+				l, h = partEqF8(ar, pv)
+			} else {
+				l = partOneF8(ar, pv)
+				h = l
+			}
+		}
+
+		sv.partStat(l, len(ar)-h, depth)
+
+		// split ranks as per partitioning
+		i := 0
+		for i < len(ks) && ks[i]-off < l {
+			i++
+		}
+		j := i
+		for j < len(ks) && ks[j]-off < h {
+			j++
+		}
+		if i > 0 {
+			multiF8(ar[:l], ks[:i], off, depth, sv)
+		}
+		ar, ks, off = ar[h:], ks[j:], off+h
+	}
+
+	if len(ks) > 0 {
+		selectF8(ar, ks[0]-off, sv)
+	}
+}
+
+// partialF8 concurrently sorts k smallest members of ar to ar[:k].
+//
+//go:nosplit
+func partialF8(ar []float64, k int, sv *syncVar) {
+	if k <= 0 {
+		return
+	}
+	if k < len(ar) {
+		selectF8(ar, k, sv)
+		ar = ar[:k]
 	}
+	sortF8(ar, sv)
 }
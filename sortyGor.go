@@ -0,0 +1,200 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// AutoGor is the default value of [MaxGor] and [Sorter].MaxGor. It derives the
+// goroutine limit of each Sort*() call from runtime.GOMAXPROCS(0) and the CPU quota
+// of the Linux cgroup (v1 or v2) of the process, whichever is smaller. Any other
+// MaxGor value overrides it. The automatic limit of a call is evaluated when it is
+// about to create its first helper goroutine, so short sorts never evaluate it. The
+// CPU quota is read at startup and refreshed in the background about once a second.
+const AutoGor uint64 = 1<<64 - 1
+
+// max automatic goroutine limit, valid MaxGor values are below 4097
+const maxAutoGor = 4096
+
+// cgroup file system and cgroups of the process, CPU quota is re-read at most once
+// per quotaTTL
+var cgroupRoot, cgroupSelf = "/sys/fs/cgroup", "/proc/self/cgroup"
+
+const quotaTTL = int64(time.Second)
+
+var (
+	quotaAt  = time.Now().UnixNano() // last quota read time in ns
+	quotaCPU = readQuota()           // CPU quota rounded up, 0 for no quota
+)
+
+// readUint returns the first field of file as a positive integer, 0 otherwise
+func readUint(file string) uint64 {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return 0
+	}
+	f := strings.Fields(string(b))
+	if len(f) == 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(f[0], 10, 64)
+	if err != nil || n <= 0 {
+		return 0 // "max" or -1 means no quota
+	}
+	return uint64(n)
+}
+
+// cgroupPaths returns v2 cgroup path and v1 cpu controller path of the process
+// from cgroupSelf, "" if absent
+func cgroupPaths() (v2, v1 string) {
+	b, err := os.ReadFile(cgroupSelf)
+	if err != nil {
+		return
+	}
+	for _, ln := range strings.Split(string(b), "\n") {
+		f := strings.SplitN(ln, ":", 3) // id:controllers:path
+		if len(f) != 3 || !strings.HasPrefix(f[2], "/") {
+			continue
+		}
+		if f[0] == "0" && f[1] == "" {
+			v2 = f[2]
+			continue
+		}
+		for _, c := range strings.Split(f[1], ",") {
+			if c == "cpu" {
+				v1 = f[2]
+			}
+		}
+	}
+	return
+}
+
+// ceilDiv returns quota/period rounded up, 0 for no quota
+func ceilDiv(quota, period uint64) uint64 {
+	if quota == 0 || period == 0 {
+		return 0
+	}
+	return (quota + period - 1) / period
+}
+
+// quotaV2 returns CPU quota of v2 cgroup dir rounded up, 0 for no quota. ok is
+// false if dir has no cpu.max file.
+func quotaV2(dir string) (q uint64, ok bool) {
+	b, err := os.ReadFile(dir + "/cpu.max")
+	if err != nil {
+		return 0, false
+	}
+	f := strings.Fields(string(b))
+	if len(f) != 2 {
+		return 0, true
+	}
+	quota, err1 := strconv.ParseUint(f[0], 10, 64) // fails for "max"
+	period, err2 := strconv.ParseUint(f[1], 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, true
+	}
+	return ceilDiv(quota, period), true
+}
+
+// quotaV1 returns CPU quota of v1 cpu cgroup dir rounded up, 0 for no quota. ok is
+// false if dir has no cpu.cfs_quota_us file.
+func quotaV1(dir string) (q uint64, ok bool) {
+	if _, err := os.Stat(dir + "/cpu.cfs_quota_us"); err != nil {
+		return 0, false
+	}
+	return ceilDiv(readUint(dir+"/cpu.cfs_quota_us"),
+		readUint(dir+"/cpu.cfs_period_us")), true
+}
+
+// readQuota returns CPU quota of the process's cgroup rounded up, 0 for no quota.
+// The cgroup is found from cgroupSelf, the smallest quota of it and its v2
+// ancestors applies. Root of the cgroup file system is used if it is not mounted.
+func readQuota() uint64 {
+	v2, v1 := cgroupPaths()
+
+	var q uint64
+	found := false
+	for p := v2; p != ""; p = path.Dir(p) { // v2 own cgroup up to root
+		if c, ok := quotaV2(cgroupRoot + strings.TrimSuffix(p, "/")); ok {
+			found = true
+			if c > 0 && (q == 0 || c < q) {
+				q = c
+			}
+		}
+		if p == "/" {
+			break
+		}
+	}
+	if found {
+		return q
+	}
+	if q, ok := quotaV2(cgroupRoot); ok { // v2 root
+		return q
+	}
+
+	if v1 != "" && v1 != "/" { // v1 own cgroup
+		if q, ok := quotaV1(cgroupRoot + "/cpu" + v1); ok {
+			return q
+		}
+	}
+	q, _ = quotaV1(cgroupRoot + "/cpu") // v1 root
+	return q
+}
+
+// refreshQuota re-reads CPU quota of the process
+func refreshQuota() {
+	atomic.StoreUint64(&quotaCPU, readQuota())
+}
+
+// autoGor returns the automatic goroutine limit, see AutoGor. A stale CPU quota is
+// refreshed by a new goroutine, so callers do not wait for file reads.
+func autoGor() uint64 {
+	now := time.Now().UnixNano()
+	if at := atomic.LoadInt64(&quotaAt); now-at > quotaTTL &&
+		atomic.CompareAndSwapInt64(&quotaAt, at, now) {
+		go refreshQuota()
+	}
+
+	g := uint64(runtime.GOMAXPROCS(0))
+	if q := atomic.LoadUint64(&quotaCPU); q > 0 && q < g {
+		g = q
+	}
+	if g > maxAutoGor {
+		g = maxAutoGor
+	}
+	return g
+}
+
+// maxG returns the current goroutine limit of sv, inlined
+//
+//go:norace
+func (sv *syncVar) maxG() uint64 {
+	mg := *sv.maxGor
+	if mg == AutoGor {
+		mg = sv.autoMax()
+	}
+	return mg
+}
+
+// autoMax returns AutoGor evaluated once for the call of sv, on its first use
+//
+//go:noinline
+func (sv *syncVar) autoMax() uint64 {
+	if g := atomic.LoadUint64(&sv.auto); g > 0 {
+		return g
+	}
+	g := autoGor()
+	atomic.StoreUint64(&sv.auto, g)
+	return g
+}
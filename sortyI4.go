@@ -6,11 +6,7 @@
 
 package sorty
 
-import (
-	"sync/atomic"
-
-	"github.com/jfcg/sixb"
-)
+import "github.com/jfcg/sixb"
 
 // isSortedI4 returns 0 if ar is sorted in ascending
 // order, otherwise it returns i > 0 with ar[i] < ar[i-1], inlined
@@ -48,12 +44,100 @@ func insertionI4(slc []int32) {
 	}
 }
 
+// heapI4 sorts slc in ascending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapI4(slc []int32) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftI4(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftI4(slc, 0, n)
+	}
+}
+
+// siftI4 moves slc[root] down in heap slc[:n], inlined
+func siftI4(slc []int32, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; top < nxt {
+				top = nxt
+				c++
+			}
+		}
+		if val >= top {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runI4 tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runI4(slc []int32) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if slc[i] < slc[i-step] {
+			fwd = false
+		} else if slc[i-step] < slc[i] {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if slc[i-1] < slc[i] {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if val >= slc[h-1] {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && val < slc[l-1]; l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
 // pivotI4 selects n equidistant samples from slc that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes even n, nsConc ≥ n ≥ 2, len(slc) ≥ 2n. Returns pivot for partitioning.
+// Assumes even n, nsConc ≥ n ≥ 2, len(slc) ≥ 2n. Returns pivot for partitioning
+// and whether samples show duplicates of it.
 //
 //go:nosplit
-func pivotI4(slc []int32, n uint) int32 {
+func pivotI4(slc []int32, n uint) (int32, bool) {
 
 	first, step, _ := minMaxSample(uint(len(slc)), n)
 
@@ -64,8 +148,8 @@ func pivotI4(slc []int32, n uint) int32 {
 	}
 	insertionI4(sample[:n]) // sort n samples
 
-	n >>= 1 // return mean of middle two samples
-	return sixb.MeanI4(sample[n-1], sample[n])
+	n >>= 1 // return mean of middle two samples, equal if duplicates
+	return sixb.MeanI4(sample[n-1], sample[n]), sample[n-1] == sample[n]
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -172,27 +256,62 @@ start:
 	}
 }
 
+// partEqI4 partitions slc into slc[:l] < pv, slc[l:h] = pv, slc[h:] > pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqI4(slc []int32, pv int32) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if x < pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv < x {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
 // new-goroutine partition
 //
 //go:nosplit
-func gPartOneI4(ar []int32, pv int32, ch chan int) {
-	ch <- partOneI4(ar, pv)
+func gPartOneI4(ar []int32, pv int32, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneI4(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
 //
 //go:nosplit
-func partConI4(slc []int32, ch chan int) int {
+func partConI4(slc []int32, sv *syncVar) int {
 
-	pv := pivotI4(slc, nsConc) // median-of-n pivot
+	pv, _ := pivotI4(slc, nsConc) // median-of-n pivot
 	mid := len(slc) >> 1
 	l, h := mid>>1, sixb.MeanI(mid, len(slc))
 
-	go gPartOneI4(slc[l:h:h], pv, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneI4(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneI4(slc[l:h:h], pv)
+	}
 
 	r := partTwoI4(slc, l, h, pv) // left/right quarter ranges
 
-	k := l + <-ch // convert returned index to slc
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
 
 	// only one gap is possible
 	if r < mid {
@@ -213,9 +332,16 @@ func partConI4(slc []int32, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenIns < len(ar) <= MaxLenRec, recursive
-func shortI4(ar []int32) {
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortI4(ar []int32, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapI4(ar)
+		return
+	}
 	first, step := minMaxFour(uint32(len(ar)))
 	a, b, c, d := ar[first], ar[first+step], ar[first+2*step], ar[first+3*step]
 
@@ -243,15 +369,16 @@ start:
 		aq = ar[k:]
 		ar = ar[:k:k]
 	}
+	sv.partStat(len(aq), len(ar), depth)
 
-	if len(aq) > MaxLenIns {
-		shortI4(aq) // recurse on the shorter range
+	if len(aq) > sv.ins {
+		shortI4(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 isort:
 	insertionI4(aq) // at least one insertion range
 
-	if len(ar) > MaxLenIns {
+	if len(ar) > sv.ins {
 		goto start
 	}
 	if &ar[0] != &aq[0] {
@@ -263,55 +390,88 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLongI4(ar []int32, sv *syncVar) {
-	longI4(ar, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLongI4(ar []int32, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longI4(ar, depth, sv)
 }
 
-// long range sort function, assumes len(ar) > MaxLenRec, recursive
-func longI4(ar []int32, sv *syncVar) {
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longI4(ar []int32, depth int, sv *syncVar) {
+	if runI4(ar) { // presorted?
+		return
+	}
 start:
-	pv := pivotI4(ar, nsLong) // median-of-n pivot
-	k := partOneI4(ar, pv)
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapI4(ar)
+		return
+	}
+	pv, dup := pivotI4(ar, nsLong) // median-of-n pivot
 	var aq []int32
 
-	if k < len(ar)-k {
-		aq = ar[:k:k]
-		ar = ar[k:] // ar is the longer range
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqI4(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortI4(aq, depth, sv)
+			} else {
+				insertionI4(aq)
+			}
+			if len(ar) > sv.ins {
+				shortI4(ar, depth, sv)
+			} else {
+				insertionI4(ar)
+			}
+			return
+		}
 	} else {
-		aq = ar[k:]
-		ar = ar[:k:k]
+		k := partOneI4(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if len(aq) <= MaxLenRec { // at least one not-long range?
+	if len(aq) <= sv.rec { // at least one not-long range?
 
-		if len(aq) > MaxLenIns {
-			shortI4(aq)
+		if len(aq) > sv.ins {
+			shortI4(aq, depth, sv)
 		} else {
 			insertionI4(aq)
 		}
 
-		if len(ar) > MaxLenRec { // two not-long ranges?
+		if len(ar) > sv.rec { // two not-long ranges?
 			goto start
 		}
-		shortI4(ar) // we know len(ar) > MaxLenIns
+		shortI4(ar, depth, sv) // we know len(ar) > sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		longI4(aq, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longI4(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLongI4(ar, sv)
+	go gLongI4(ar, depth, sv)
 	ar = aq
 	goto start
 }
@@ -319,26 +479,39 @@ start:
 // sortI4 concurrently sorts ar in ascending order.
 //
 //go:nosplit
-func sortI4(ar []int32) {
+func sortI4(ar []int32, sv *syncVar) {
 
-	if len(ar) < 2*(MaxLenRec+1) || MaxGor <= 1 {
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
 
-		if len(ar) > MaxLenRec { // single-goroutine sorting
-			longI4(ar, nil)
-		} else if len(ar) > MaxLenIns {
-			shortI4(ar)
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longI4(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortI4(ar, depth, sv)
 		} else {
 			insertionI4(ar)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runI4(ar) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	for {
 		// concurrent dual partitioning with done
-		k := partConI4(ar, sv.done)
+		k := partConI4(ar, sv)
+		depth--
 		var aq []int32
 
 		if k < len(ar)-k {
@@ -348,28 +521,155 @@ func sortI4(ar []int32) {
 			aq = ar[k:]
 			ar = ar[:k:k]
 		}
+		sv.partStat(len(aq), len(ar), depth)
 
 		// handle shorter range
-		if len(aq) > MaxLenRec {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLongI4(aq, &sv)
-
-		} else if len(aq) > MaxLenIns {
-			shortI4(aq)
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongI4(aq, depth, sv)
+			} else {
+				longI4(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortI4(aq, depth, sv)
 		} else {
 			insertionI4(aq)
 		}
 
-		// longer range big enough? max goroutines?
-		if len(ar) < 2*(MaxLenRec+1) || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	longI4(ar, &sv) // we know len(ar) > MaxLenRec
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longI4(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
+}
+
+// selectI4 moves k-th smallest member of ar to ar[k], so that
+// ar[:k] ≤ ar[k] ≤ ar[k+1:]. It recurses only into the range that contains k.
+// Assumes 0 ≤ k < len(ar).
+func selectI4(ar []int32, k int, sv *syncVar) {
+	depth := maxDepth(len(ar)) // partitioning budget
+	for len(ar) > sv.rec {
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapI4(ar)
+			return
+		}
+
+		var m int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			m = partConI4(ar, sv) // concurrent dual partitioning
+		} else {
+			pv, dup := pivotI4(ar, nsLong) // median-of-n pivot
+
+			if dup { // exclude members equal to pivot
+				l, h := partEqI4(ar, pv)
+				sv.partStat(l, len(ar)-h, depth)
+				if k < l {
+					ar = ar[:l]
+				} else if k < h {
+					return // ar[k] = pivot
+				} else {
+					ar = ar[h:]
+					k -= h
+				}
+				continue
+			}
+			m = partOneI4(ar, pv)
+		}
+
+		sv.partStat(m, len(ar)-m, depth)
+		if k < m {
+			ar = ar[:m]
+		} else {
+			ar = ar[m:]
+			k -= m
+		}
+	}
+
+	if len(ar) > sv.ins {
+		shortI4(ar, depth, sv)
+	} else {
+		insertionI4(ar)
+	}
+}
+
+// multiI4 moves ks[i]-th smallest member to ar[ks[i]-off] for each i, where ks
+// are ascending ranks and ar starts at rank off. It recurses only into ranges
+// that contain requested ranks. Assumes off ≤ ks[i] < off+len(ar).
+func multiI4(ar []int32, ks []int, off, depth int, sv *syncVar) {
+	for len(ks) > 1 {
+		if len(ar) <= sv.rec {
+			if len(ar) > sv.ins {
+				shortI4(ar, depth, sv)
+			} else {
+				insertionI4(ar)
+			}
+			return
+		}
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapI4(ar)
+			return
+		}
+
+		var l, h int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partConI4(ar, sv) // concurrent dual partitioning
+			h = l
+		} else {
+			pv, dup := pivotI4(ar, nsLong) // median-of-n pivot
+
+			if dup { // members equal to pivot are in ar[l:h]
+				l, h = partEqI4(ar, pv)
+			} else {
+				l = partOneI4(ar, pv)
+				h = l
+			}
+		}
+
+		sv.partStat(l, len(ar)-h, depth)
+
+		// split ranks as per partitioning
+		i := 0
+		for i < len(ks) && ks[i]-off < l {
+			i++
+		}
+		j := i
+		for j < len(ks) && ks[j]-off < h {
+			j++
+		}
+		if i > 0 {
+			multiI4(ar[:l], ks[:i], off, depth, sv)
+		}
+		ar, ks, off = ar[h:], ks[j:], off+h
+	}
+
+	if len(ks) > 0 {
+		selectI4(ar, ks[0]-off, sv)
+	}
+}
 
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
+// partialI4 concurrently sorts k smallest members of ar to ar[:k].
+//
+//go:nosplit
+func partialI4(ar []int32, k int, sv *syncVar) {
+	if k <= 0 {
+		return
+	}
+	if k < len(ar) {
+		selectI4(ar, k, sv)
+		ar = ar[:k]
 	}
+	sortI4(ar, sv)
 }
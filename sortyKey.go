@@ -0,0 +1,154 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/jfcg/sixb"
+)
+
+// Ordered is the set of key types [SortByKey]() accepts, same as cmp.Ordered.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 |
+		~uint64 | ~uintptr | ~float32 | ~float64 | ~string
+}
+
+// min slice length per goroutine for key extraction
+const keyMin = 1 << 12
+
+// extract keys of s[lo:hi] into keys
+func extract[T any, K Ordered](s []T, keys []K, key func(T) K, lo, hi int) {
+	for i := lo; i < hi; i++ {
+		keys[i] = key(s[i])
+	}
+}
+
+// new-goroutine key extraction
+func gExtract[T any, K Ordered](s []T, keys []K, key func(T) K, lo, hi int,
+	sv *syncVar, ch chan int) {
+	defer gEnd(sv, ch)
+	extract(s, keys, key, lo, hi)
+}
+
+// keysOf concurrently extracts keys of s
+func keysOf[T any, K Ordered](s []T, key func(T) K, sv *syncVar) []K {
+	keys := make([]K, len(s))
+	g := numGor(len(s), keyMin, sv)
+	if g == 1 {
+		extract(s, keys, key, 0, len(s))
+		return keys
+	}
+
+	ch := make(chan int)
+	for c := g - 1; c > 0; c-- {
+		go gExtract(s, keys, key, c*len(s)/g, (c+1)*len(s)/g, sv, ch)
+	}
+	defer sv.join(g, ch) // wait for goroutines, propagate panics
+	extract(s, keys, key, 0, len(s)/g)
+	return keys
+}
+
+// key32 returns integer key *p of at most 32 bits as uint32, inlined
+func key32[K Ordered](p *K) uint32 {
+	switch unsafe.Sizeof(*p) {
+	case 1:
+		return uint32(*(*uint8)(unsafe.Pointer(p)))
+	case 2:
+		return uint32(*(*uint16)(unsafe.Pointer(p)))
+	}
+	return *(*uint32)(unsafe.Pointer(p))
+}
+
+// packedPerm sorts integer keys of at most 32 bits natively by packing each key
+// with its index into a uint64, returns the sorting permutation. flip is the sign
+// bit for signed kinds.
+func packedPerm[K Ordered](keys []K, flip uint32, sv *syncVar) []int {
+	pk := make([]uint64, len(keys))
+	for i := range keys {
+		pk[i] = uint64(key32(&keys[i])^flip)<<32 | uint64(i)
+	}
+	sortU8(pk, sv)
+
+	perm := make([]int, len(pk))
+	for i, x := range pk {
+		perm[i] = int(uint32(x))
+	}
+	return perm
+}
+
+// keys32 returns integer keys of at most 32 bits as uint32s of the same order.
+// flip is the sign bit for signed kinds.
+func keys32[K Ordered](keys []K, flip uint32) []uint32 {
+	ks := make([]uint32, len(keys))
+	for i := range keys {
+		ks[i] = key32(&keys[i]) ^ flip
+	}
+	return ks
+}
+
+// sortByKey sorts s by keys extracted once per member
+func sortByKey[T any, K Ordered](s []T, key func(T) K, srt *Sorter) {
+	if len(s) < 2 {
+		return
+	}
+	var k K
+	sz := unsafe.Sizeof(k)
+	kind := reflect.TypeOf(k).Kind()
+	switch kind { // map int/uint/uintptr to hardware type
+	case reflect.Int:
+		kind = intKind
+	case reflect.Uint:
+		kind = uintKind
+	case reflect.Uintptr:
+		kind = uptrKind
+	}
+	var flip uint32 // sign bit of signed integer keys of at most 32 bits
+	if reflect.Int8 <= kind && kind <= reflect.Int32 {
+		flip = 1 << (8*sz - 1)
+	}
+
+	// packed keys are sorted as uint64s, others together with their indices
+	native := sz > 4 || kind == reflect.Float32 || kind == reflect.String
+	packed := !native && uint64(len(s)) <= 1<<32
+	var sv *syncVar
+	switch {
+	case native:
+		sv = srt.kindVar(sliceKind(kind))
+	case packed:
+		sv = srt.kindVar(KindU8)
+	default:
+		sv = srt.kindVar(KindU4)
+	}
+	keys := keysOf(s, key, sv)
+
+	var perm []int
+	switch {
+	case native:
+		perm = identity(len(s))
+		argKind(*(*sixb.Slice)(unsafe.Pointer(&keys)), kind, perm, sv)
+	case packed:
+		perm = packedPerm(keys, flip, sv)
+	default: // too many members to pack
+		perm = identity(len(s))
+		argNative(keys32(keys, flip), perm, sv)
+	}
+	applyOf(s, perm, srt.newVar(false)) // sorting ended goroutine counter of sv
+}
+
+// SortByKey concurrently sorts s in ascending order of key(s[i]). key() is called
+// once per member (concurrently with up to [MaxGor] goroutines, so it must be safe
+// for concurrent use), then keys are sorted together with member indices and the
+// resulting permutation is applied to s in-place. Keys are compared natively:
+// integer keys of at most 32 bits are packed with their indices, others are sorted
+// with them like [ArgSortSlice](). Float NaN keys are handled as per [NaNoption].
+// It allocates keys and up to a key and three words per member of s. Sorting is
+// stable.
+func SortByKey[T any, K Ordered](s []T, key func(T) K) {
+	sortByKey(s, key, std)
+}
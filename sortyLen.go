@@ -7,10 +7,68 @@
 package sorty
 
 import (
+	"context"
 	"reflect"
 	"unsafe"
+
+	"github.com/jfcg/sixb"
 )
 
+// isSortedLenSK returns -1 for unrecognized kinds
+//
+//go:nosplit
+func isSortedLenSK(slc sixb.Slice, kind reflect.Kind, desc bool) int {
+	switch {
+	case kind == reflect.String:
+		s := *(*[]string)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescLenS(s)
+		}
+		return isSortedLenS(s)
+	case kind >= sliceBias:
+		b := *(*[][]byte)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescLenB(b)
+		}
+		return isSortedLenB(b)
+	}
+	return -1
+}
+
+// sortLenSK returns false for unrecognized kinds
+//
+//go:nosplit
+func sortLenSK(slc sixb.Slice, kind reflect.Kind, desc bool, srt *Sorter,
+	ctx context.Context) bool {
+
+	k := KindLenB
+	if kind == reflect.String {
+		k = KindLenS
+	}
+	sv := srt.kindVar(k)
+	sv.setCtx(ctx) // nil for no cancellation
+
+	switch {
+	case kind == reflect.String:
+		s := *(*[]string)(unsafe.Pointer(&slc))
+		if desc {
+			sortDescLenS(s, sv)
+		} else {
+			sortLenS(s, sv)
+		}
+	case kind >= sliceBias:
+		b := *(*[][]byte)(unsafe.Pointer(&slc))
+		if desc {
+			sortDescLenB(b, sv)
+		} else {
+			sortLenB(b, sv)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
 // IsSortedLen returns 0 if ar is sorted 'by length' in ascending order, otherwise
 // it returns i > 0 with len(ar[i]) < len(ar[i-1]). ar's (underlying) type can be
 //
@@ -21,13 +79,8 @@ import (
 //go:nosplit
 func IsSortedLen(ar any) int {
 	slc, kind := extractSK(ar)
-	switch {
-	case kind == reflect.String:
-		s := *(*[]string)(unsafe.Pointer(&slc))
-		return isSortedLenS(s)
-	case kind >= sliceBias:
-		b := *(*[][]byte)(unsafe.Pointer(&slc))
-		return isSortedLenB(b)
+	if i := isSortedLenSK(slc, kind, false); i >= 0 {
+		return i
 	}
 	panic("sorty: IsSortedLen: invalid input type")
 }
@@ -42,14 +95,43 @@ func IsSortedLen(ar any) int {
 //go:nosplit
 func SortLen(ar any) {
 	slc, kind := extractSK(ar)
-	switch {
-	case kind == reflect.String:
-		s := *(*[]string)(unsafe.Pointer(&slc))
-		sortLenS(s)
-	case kind >= sliceBias:
-		b := *(*[][]byte)(unsafe.Pointer(&slc))
-		sortLenB(b)
-	default:
+	if !sortLenSK(slc, kind, false, std, nil) {
 		panic("sorty: SortLen: invalid input type")
 	}
 }
+
+// SortLenContext is like [SortLen]() but can be canceled via ctx. Sorting goroutines
+// stop promptly when ctx is done, and it returns ctx.Err() after they all stop. A non-nil
+// result means ar may not be sorted, but it is always a permutation of its input.
+//
+//go:nosplit
+func SortLenContext(ctx context.Context, ar any) error {
+	slc, kind := extractSK(ar)
+	if !sortLenSK(slc, kind, false, std, ctx) {
+		panic("sorty: SortLenContext: invalid input type")
+	}
+	return ctx.Err()
+}
+
+// IsSortedLenDesc returns 0 if ar is sorted 'by length' in descending order, otherwise
+// it returns i > 0 with len(ar[i]) > len(ar[i-1]). ar's type can be as in [IsSortedLen]().
+//
+//go:nosplit
+func IsSortedLenDesc(ar any) int {
+	slc, kind := extractSK(ar)
+	if i := isSortedLenSK(slc, kind, true); i >= 0 {
+		return i
+	}
+	panic("sorty: IsSortedLenDesc: invalid input type")
+}
+
+// SortLenDesc concurrently sorts ar 'by length' in descending order.
+// ar's type can be as in [SortLen](), otherwise it panics.
+//
+//go:nosplit
+func SortLenDesc(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortLenSK(slc, kind, true, std, nil) {
+		panic("sorty: SortLenDesc: invalid input type")
+	}
+}
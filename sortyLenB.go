@@ -6,11 +6,7 @@
 
 package sorty
 
-import (
-	"sync/atomic"
-
-	"github.com/jfcg/sixb"
-)
+import "github.com/jfcg/sixb"
 
 // isSortedLenB returns 0 if ar is sorted by length in ascending
 // order, otherwise it returns i > 0 with len(ar[i]) < len(ar[i-1]), inlined
@@ -48,12 +44,100 @@ func insertionLenB(slc [][]byte) {
 	}
 }
 
+// heapLenB sorts slc by length in ascending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapLenB(slc [][]byte) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftLenB(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftLenB(slc, 0, n)
+	}
+}
+
+// siftLenB moves slc[root] down in heap slc[:n], inlined
+func siftLenB(slc [][]byte, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; len(top) < len(nxt) {
+				top = nxt
+				c++
+			}
+		}
+		if len(val) >= len(top) {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runLenB tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runLenB(slc [][]byte) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if len(slc[i]) < len(slc[i-step]) {
+			fwd = false
+		} else if len(slc[i-step]) < len(slc[i]) {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if len(slc[i-1]) < len(slc[i]) {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if len(val) >= len(slc[h-1]) {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && len(val) < len(slc[l-1]); l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
 // pivotLenB selects n equidistant samples from slc that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes even n, nsConc ≥ n ≥ 2, len(slc) ≥ 2n. Returns pivot for partitioning.
+// Assumes even n, nsConc ≥ n ≥ 2, len(slc) ≥ 2n. Returns pivot for partitioning
+// and whether samples show duplicates of it.
 //
 //go:nosplit
-func pivotLenB(slc [][]byte, n uint) int {
+func pivotLenB(slc [][]byte, n uint) (int, bool) {
 
 	first, step, _ := minMaxSample(uint(len(slc)), n)
 
@@ -64,8 +148,8 @@ func pivotLenB(slc [][]byte, n uint) int {
 	}
 	insertionI(sample[:n]) // sort n samples
 
-	n >>= 1 // return mean of middle two samples
-	return sixb.MeanI(sample[n-1], sample[n])
+	n >>= 1 // return mean of middle two samples, equal if duplicates
+	return sixb.MeanI(sample[n-1], sample[n]), sample[n-1] == sample[n]
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -172,27 +256,62 @@ start:
 	}
 }
 
+// partEqLenB partitions slc into slc[:l] < pv, slc[l:h] = pv, slc[h:] > pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqLenB(slc [][]byte, pv int) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if len(x) < pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv < len(x) {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
 // new-goroutine partition
 //
 //go:nosplit
-func gPartOneLenB(ar [][]byte, pv int, ch chan int) {
-	ch <- partOneLenB(ar, pv)
+func gPartOneLenB(ar [][]byte, pv int, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneLenB(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
 //
 //go:nosplit
-func partConLenB(slc [][]byte, ch chan int) int {
+func partConLenB(slc [][]byte, sv *syncVar) int {
 
-	pv := pivotLenB(slc, nsConc) // median-of-n pivot
+	pv, _ := pivotLenB(slc, nsConc) // median-of-n pivot
 	mid := len(slc) >> 1
 	l, h := mid>>1, sixb.MeanI(mid, len(slc))
 
-	go gPartOneLenB(slc[l:h:h], pv, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneLenB(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneLenB(slc[l:h:h], pv)
+	}
 
 	r := partTwoLenB(slc, l, h, pv) // left/right quarter ranges
 
-	k := l + <-ch // convert returned index to slc
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
 
 	// only one gap is possible
 	if r < mid {
@@ -213,9 +332,16 @@ func partConLenB(slc [][]byte, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenIns < len(ar) <= MaxLenRec, recursive
-func shortLenB(ar [][]byte) {
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortLenB(ar [][]byte, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapLenB(ar)
+		return
+	}
 	first, step := minMaxFour(uint32(len(ar)))
 	a, b := len(ar[first]), len(ar[first+step])
 	c, d := len(ar[first+2*step]), len(ar[first+3*step])
@@ -244,15 +370,16 @@ start:
 		aq = ar[k:]
 		ar = ar[:k:k]
 	}
+	sv.partStat(len(aq), len(ar), depth)
 
-	if len(aq) > MaxLenIns {
-		shortLenB(aq) // recurse on the shorter range
+	if len(aq) > sv.ins {
+		shortLenB(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 isort:
 	insertionLenB(aq) // at least one insertion range
 
-	if len(ar) > MaxLenIns {
+	if len(ar) > sv.ins {
 		goto start
 	}
 	if &ar[0] != &aq[0] {
@@ -264,55 +391,88 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLongLenB(ar [][]byte, sv *syncVar) {
-	longLenB(ar, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLongLenB(ar [][]byte, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longLenB(ar, depth, sv)
 }
 
-// long range sort function, assumes len(ar) > MaxLenRec, recursive
-func longLenB(ar [][]byte, sv *syncVar) {
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longLenB(ar [][]byte, depth int, sv *syncVar) {
+	if runLenB(ar) { // presorted?
+		return
+	}
 start:
-	pv := pivotLenB(ar, nsLong) // median-of-n pivot
-	k := partOneLenB(ar, pv)
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapLenB(ar)
+		return
+	}
+	pv, dup := pivotLenB(ar, nsLong) // median-of-n pivot
 	var aq [][]byte
 
-	if k < len(ar)-k {
-		aq = ar[:k:k]
-		ar = ar[k:] // ar is the longer range
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqLenB(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortLenB(aq, depth, sv)
+			} else {
+				insertionLenB(aq)
+			}
+			if len(ar) > sv.ins {
+				shortLenB(ar, depth, sv)
+			} else {
+				insertionLenB(ar)
+			}
+			return
+		}
 	} else {
-		aq = ar[k:]
-		ar = ar[:k:k]
+		k := partOneLenB(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if len(aq) <= MaxLenRec { // at least one not-long range?
+	if len(aq) <= sv.rec { // at least one not-long range?
 
-		if len(aq) > MaxLenIns {
-			shortLenB(aq)
+		if len(aq) > sv.ins {
+			shortLenB(aq, depth, sv)
 		} else {
 			insertionLenB(aq)
 		}
 
-		if len(ar) > MaxLenRec { // two not-long ranges?
+		if len(ar) > sv.rec { // two not-long ranges?
 			goto start
 		}
-		shortLenB(ar) // we know len(ar) > MaxLenIns
+		shortLenB(ar, depth, sv) // we know len(ar) > sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		longLenB(aq, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longLenB(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLongLenB(ar, sv)
+	go gLongLenB(ar, depth, sv)
 	ar = aq
 	goto start
 }
@@ -320,26 +480,39 @@ start:
 // sortLenB concurrently sorts ar by length in ascending order.
 //
 //go:nosplit
-func sortLenB(ar [][]byte) {
+func sortLenB(ar [][]byte, sv *syncVar) {
 
-	if len(ar) < 2*(MaxLenRec+1) || MaxGor <= 1 {
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
 
-		if len(ar) > MaxLenRec { // single-goroutine sorting
-			longLenB(ar, nil)
-		} else if len(ar) > MaxLenIns {
-			shortLenB(ar)
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longLenB(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortLenB(ar, depth, sv)
 		} else {
 			insertionLenB(ar)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runLenB(ar) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	for {
 		// concurrent dual partitioning with done
-		k := partConLenB(ar, sv.done)
+		k := partConLenB(ar, sv)
+		depth--
 		var aq [][]byte
 
 		if k < len(ar)-k {
@@ -349,28 +522,31 @@ func sortLenB(ar [][]byte) {
 			aq = ar[k:]
 			ar = ar[:k:k]
 		}
+		sv.partStat(len(aq), len(ar), depth)
 
 		// handle shorter range
-		if len(aq) > MaxLenRec {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLongLenB(aq, &sv)
-
-		} else if len(aq) > MaxLenIns {
-			shortLenB(aq)
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongLenB(aq, depth, sv)
+			} else {
+				longLenB(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortLenB(aq, depth, sv)
 		} else {
 			insertionLenB(aq)
 		}
 
-		// longer range big enough? max goroutines?
-		if len(ar) < 2*(MaxLenRec+1) || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	longLenB(ar, &sv) // we know len(ar) > MaxLenRec
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
-	}
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longLenB(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
 }
@@ -7,7 +7,7 @@
 package sorty
 
 import (
-	"sync/atomic"
+	"context"
 
 	"github.com/jfcg/sixb"
 )
@@ -50,13 +50,97 @@ func insertion(lsw Lesswap, lo, hi int) {
 	}
 }
 
+// heap sorts ar[lo..hi] via heapsort, which is used when partitioning
+// budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heap(lsw Lesswap, lo, hi int) {
+	n := hi + 1 - lo
+	for i := n>>1 - 1; i >= 0; i-- {
+		sift(lsw, lo, i, n)
+	}
+	for n--; n > 0; n-- {
+		lsw(lo+n, lo, lo+n, lo) // top to the end, no swap if equal
+		sift(lsw, lo, 0, n)
+	}
+}
+
+// sift moves ar[lo+root] down in heap ar[lo:lo+n], inlined
+func sift(lsw Lesswap, lo, root, n int) {
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		if c+1 < n && lsw(lo+c, lo+c+1, lo, lo) { // 3rd=4th disables swap
+			c++
+		}
+		if !lsw(lo+root, lo+c, lo+root, lo+c) {
+			break
+		}
+		root = c
+	}
+}
+
+// run tries to finish ar[lo..hi] in linear time if its samples are in (reverse)
+// order. Range is reversed if it is in reverse order, or insertion sorted if it
+// has at most nsLong misplaced members, each within maxShift of its place. Returns
+// true if range is sorted.
+//
+//go:nosplit
+func run(lsw Lesswap, lo, hi int) bool {
+	f, s, l := minMaxSample(uint(hi+1-lo), nsLong)
+	first := lo + int(f)
+	step := int(s)
+	last := lo + int(l)
+
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if lsw(i, i-step, i, i) { // 3rd=4th disables swap
+			fwd = false
+		} else if lsw(i-step, i, i, i) {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := hi; i > lo; i-- {
+			if lsw(i-1, i, i, i) { // 3rd=4th disables swap
+				return false
+			}
+		}
+		for ; lo < hi; lo, hi = lo+1, hi-1 {
+			lsw(hi, lo, lo, hi) // no swap if equal
+		}
+		return true
+	}
+
+	for h, n := lo+1, nsLong; h <= hi; h++ {
+		if !lsw(h, h-1, h, h-1) {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		for l := h - 1; l > lo; l-- {
+			if h-l >= maxShift {
+				return false // too long shift
+			}
+			if !lsw(l, l-1, l, l-1) {
+				break
+			}
+		}
+	}
+	return true
+}
+
 // pivot selects n equidistant samples from slc[lo:hi+1] that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes odd n ≥ 3 and len(slc) ≥ 2n. Returns pivot position.
-// Moves one sorted sample to each end to ensure sub-slices have lengths ≥ 1
+// Assumes odd n ≥ 3 and len(slc) ≥ 2n. Returns pivot position and whether samples
+// show duplicates of it. Moves one sorted sample to each end to ensure sub-slices
+// have lengths ≥ 1
 //
 //go:nosplit
-func pivot(lsw Lesswap, lo, hi int, n uint) int {
+func pivot(lsw Lesswap, lo, hi int, n uint) (int, bool) {
 
 	f, s, l := minMaxSample(uint(hi+1-lo), n)
 	first := lo + int(f)
@@ -73,11 +157,15 @@ func pivot(lsw Lesswap, lo, hi int, n uint) int {
 		}
 	}
 
+	// middle sample equal to a neighbor if duplicates, 3rd=4th disables swap
+	pv := sixb.MeanI(first, last)
+	dup := !lsw(pv-step, pv, pv, pv) || !lsw(pv, pv+step, pv, pv)
+
 	// move one sorted sample to each end
 	lsw(first, lo, first, lo)
 	lsw(hi, last, hi, last)
 
-	return sixb.MeanI(first, last)
+	return pv, dup
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -159,28 +247,83 @@ func partTwo(lsw Lesswap, lo, l, pv, h, hi int) int {
 	}
 }
 
-// new-goroutine partition
+// partEq partitions slc[lo..hi] into slc[lo..l-1] < pivot, slc[l..h] = pivot,
+// slc[h+1..hi] > pivot (Dutch national flag), so members equal to pivot are
+// excluded from recursion. Returns l, h.
 //
 //go:nosplit
-func gPartOne(lsw Lesswap, l, pv, h int, ch chan int) {
-	ch <- partOne(lsw, l, pv, h)
+func partEq(lsw Lesswap, lo, pv, hi int) (l, h int) {
+	// move pivot to lo, swaps unless equal
+	if !lsw(pv, lo, pv, lo) {
+		lsw(lo, pv, lo, pv)
+	}
+
+	// slc[l] is always equal to pivot
+	l, h = lo, hi
+	for m := lo + 1; m <= h; {
+		if lsw(m, l, l, m) { // slc[m] < pivot
+			l++
+			m++
+		} else if lsw(l, m, m, h) { // slc[m] > pivot
+			h--
+		} else {
+			m++
+		}
+	}
+	return
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// new-goroutine partition, sends -1 if lsw panics
 //
 //go:nosplit
-func partCon(lsw Lesswap, lo, hi int, ch chan int) int {
+func gPartOne(lsw Lesswap, l, pv, h int, sv *syncVar) {
+	k, r := -1, gStart(sv, regionPart)
+	defer func() {
+		endRegion(r)
+		if p := recover(); p != nil {
+			sv.fail(p) // cancels sorting
+		}
+		subGor(sv, 1) // decrease goroutine counters
+		sv.done <- k
+	}()
+	k = partOne(lsw, l, pv, h)
+}
+
+// awaitOne is deferred by partCon, it waits for gPartOne if partCon panics before
+func awaitOne(ch chan int, waiting *bool) {
+	if *waiting {
+		<-ch
+	}
+}
 
-	pv := pivot(lsw, lo, hi, nsConc-1) // median-of-n pivot
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+//
+//go:nosplit
+func partCon(lsw Lesswap, lo, hi int, sv *syncVar) int {
+
+	pv, _ := pivot(lsw, lo, hi, nsConc-1) // median-of-n pivot
 	lo++
 	hi--
 	l, h := sixb.MeanI(lo, pv), sixb.MeanI(pv, hi)
 
-	go gPartOne(lsw, l+1, pv, h-1, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	ch, waiting := sv.done, addGor(sv, 1) // increase goroutine counters
+	if waiting {
+		go gPartOne(lsw, l+1, pv, h-1, sv)
+	}
+	defer awaitOne(ch, &waiting)
 
 	r := partTwo(lsw, lo, l, pv, h, hi) // left/right quarter ranges
 
-	k := <-ch
+	var k int
+	if waiting {
+		k = <-ch
+		if waiting = false; k < 0 {
+			sv.rethrow() // gPartOne panicked
+		}
+	} else {
+		k = partOne(lsw, l+1, pv, h-1)
+	}
 
 	// only one gap is possible
 	if r < pv {
@@ -205,9 +348,16 @@ func partCon(lsw Lesswap, lo, hi int, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenInsFC <= hi-lo < MaxLenRecFC, recursive
-func short(lsw Lesswap, lo, hi int) {
+// short range sort function, assumes sv.ins <= hi-lo < sv.rec, recursive
+func short(lsw Lesswap, lo, hi, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heap(lsw, lo, hi)
+		return
+	}
 	fr, step, _ := minMaxSample(uint(hi+1-lo), 3)
 	first := lo + int(fr)
 	pv := first + int(step)
@@ -232,9 +382,10 @@ start:
 	} else {
 		h, hi = hi, h
 	}
+	sv.partStat(n+1, no+1, depth)
 
-	if n >= MaxLenInsFC {
-		short(lsw, l, h) // recurse on the shorter range
+	if n >= sv.ins {
+		short(lsw, l, h, depth, sv) // recurse on the shorter range
 		goto start
 	}
 	// at least one insertion range, insertion inlined
@@ -248,7 +399,7 @@ isort:
 		}
 	}
 
-	if no >= MaxLenInsFC {
+	if no >= sv.ins {
 		goto start
 	}
 	if lo != l {
@@ -260,102 +411,135 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLong(lsw Lesswap, lo, hi int, sv *syncVar) {
-	long(lsw, lo, hi, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLong(lsw Lesswap, lo, hi, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	long(lsw, lo, hi, depth, sv)
 }
 
-// long range sort function, assumes hi-lo >= MaxLenRecFC, recursive
-func long(lsw Lesswap, lo, hi int, sv *syncVar) {
+// long range sort function, assumes hi-lo >= sv.rec, recursive
+func long(lsw Lesswap, lo, hi, depth int, sv *syncVar) {
+	if run(lsw, lo, hi) { // presorted?
+		return
+	}
 start:
-	pv := pivot(lsw, lo, hi, nsLong-1) // median-of-n pivot
-	l := partOne(lsw, lo+1, pv, hi-1)
-	h := l - 1
-	no, n := h-lo, hi-l
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heap(lsw, lo, hi)
+		return
+	}
+	pv, dup := pivot(lsw, lo, hi, nsLong-1) // median-of-n pivot
+	var l, h, no, n int
 
-	if no < n {
-		n, no = no, n // [lo,hi] is the longer range
-		l, lo = lo, l
+	if dup { // exclude members equal to pivot from recursion
+		l, h = partEq(lsw, lo, pv, hi)
+		l, h, hi = h+1, hi, l-1
+		no, n = hi-lo, h-l
+
+		if no < n {
+			n, no = no, n // [lo,hi] is the longer range
+			l, lo = lo, l
+			h, hi = hi, h
+		}
+		sv.partStat(n+1, no+1, depth)
+
+		if no < sv.rec { // two not-long ranges?
+			if n >= sv.ins {
+				short(lsw, l, h, depth, sv)
+			} else {
+				insertion(lsw, l, h)
+			}
+			if no >= sv.ins {
+				short(lsw, lo, hi, depth, sv)
+			} else {
+				insertion(lsw, lo, hi)
+			}
+			return
+		}
 	} else {
-		h, hi = hi, h
+		l = partOne(lsw, lo+1, pv, hi-1)
+		h = l - 1
+		no, n = h-lo, hi-l
+
+		if no < n {
+			n, no = no, n // [lo,hi] is the longer range
+			l, lo = lo, l
+		} else {
+			h, hi = hi, h
+		}
+		sv.partStat(n+1, no+1, depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if n < MaxLenRecFC { // at least one not-long range?
+	if n < sv.rec { // at least one not-long range?
 
-		if n >= MaxLenInsFC {
-			short(lsw, l, h)
+		if n >= sv.ins {
+			short(lsw, l, h, depth, sv)
 		} else {
 			insertion(lsw, l, h)
 		}
 
-		if no >= MaxLenRecFC { // two not-long ranges?
+		if no >= sv.rec { // two not-long ranges?
 			goto start
 		}
-		short(lsw, lo, hi) // we know no >= MaxLenInsFC
+		short(lsw, lo, hi, depth, sv) // we know no >= sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		long(lsw, l, h, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		long(lsw, l, h, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLong(lsw, lo, hi, sv)
+	go gLong(lsw, lo, hi, depth, sv)
 	lo, hi = l, h
 	goto start
 }
 
-// Sort concurrently sorts underlying collection of length n via lsw().
-// Once for each non-trivial type you want to sort in a certain way, you
-// can implement a custom sorting routine (for a slice for example) as:
-//
-//	func SortTypeAscending(slc []Type) {
-//		lsw := func(i, k, r, s int) bool {
-//			if slc[i].Key < slc[k].Key { // strict comparator like < or >
-//				if r != s {
-//					slc[r], slc[s] = slc[s], slc[r]
-//				}
-//				return true
-//			}
-//			return false
-//		}
-//		sorty.Sort(len(slc), lsw)
-//	}
-//
-// [Lesswap] is a contract between users and sorty. Strict
-// comparator, r!=s check, swap and returns are all necessary.
+// sortLw concurrently sorts underlying collection of length n via lsw().
 //
 //go:nosplit
-func Sort(n int, lsw Lesswap) {
-
-	n-- // high index
-	if n <= 2*MaxLenRecFC || MaxGor <= 1 {
-
-		if n >= MaxLenRecFC { // single-goroutine sorting
-			long(lsw, 0, n, nil)
-		} else if n >= MaxLenInsFC {
-			short(lsw, 0, n)
+func sortLw(n int, lsw Lesswap, sv *syncVar) {
+
+	n--                  // high index
+	depth := maxDepth(n) // partitioning budget
+	if n <= 2*sv.rec || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
+
+		if n >= sv.rec { // single-goroutine sorting
+			long(lsw, 0, n, depth, sv)
+		} else if n >= sv.ins {
+			short(lsw, 0, n, depth, sv)
 		} else if n > 0 {
 			insertion(lsw, 0, n)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if run(lsw, 0, n) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	lo, hi := 0, n
 	for {
 		// concurrent dual partitioning with done
-		l := partCon(lsw, lo, hi, sv.done)
+		l := partCon(lsw, lo, hi, sv)
+		depth--
 		h := l - 1
 		no, n := h-lo, hi-l
 
@@ -365,28 +549,192 @@ func Sort(n int, lsw Lesswap) {
 		} else {
 			h, hi = hi, h
 		}
+		sv.partStat(n+1, no+1, depth)
 
 		// handle shorter range
-		if n >= MaxLenRecFC {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLong(lsw, l, h, &sv)
-
-		} else if n >= MaxLenInsFC {
-			short(lsw, l, h)
+		if n >= sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLong(lsw, l, h, depth, sv)
+			} else {
+				long(lsw, l, h, depth, sv) // budget is full
+			}
+		} else if n >= sv.ins {
+			short(lsw, l, h, depth, sv)
 		} else {
 			insertion(lsw, l, h)
 		}
 
-		// longer range big enough? max goroutines?
-		if no <= 2*MaxLenRecFC || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if no <= 2*sv.rec || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	long(lsw, lo, hi, &sv) // we know hi-lo >= MaxLenRecFC
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	long(lsw, lo, hi, depth, sv) // we know hi-lo >= sv.rec
+	sv.leave()
+}
+
+// sel moves k-th smallest member of slc[lo..hi] to slc[k], so that
+// slc[lo..k-1] ≤ slc[k] ≤ slc[k+1..hi]. It recurses only into the range
+// that contains k. Assumes lo ≤ k ≤ hi.
+func sel(lsw Lesswap, lo, hi, k int, sv *syncVar) {
+	depth := maxDepth(hi + 1 - lo) // partitioning budget
+	for hi-lo >= sv.rec {
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heap(lsw, lo, hi)
+			return
+		}
+
+		var l int
+		if hi-lo > 2*sv.rec && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partCon(lsw, lo, hi, sv) // concurrent dual partitioning
+		} else {
+			pv, dup := pivot(lsw, lo, hi, nsLong-1) // median-of-n pivot
+
+			if dup { // exclude members equal to pivot
+				l, h := partEq(lsw, lo, pv, hi)
+				sv.partStat(l-lo, hi-h, depth)
+				if k < l {
+					hi = l - 1
+				} else if k <= h {
+					return // slc[k] = pivot
+				} else {
+					lo = h + 1
+				}
+				continue
+			}
+			l = partOne(lsw, lo+1, pv, hi-1)
+		}
+
+		sv.partStat(l-lo, hi+1-l, depth)
+		if k < l {
+			hi = l - 1
+		} else {
+			lo = l
+		}
+	}
+
+	if hi-lo >= sv.ins {
+		short(lsw, lo, hi, depth, sv)
+	} else {
+		insertion(lsw, lo, hi)
+	}
+}
+
+// multi moves ks[i]-th smallest member of slc[lo..hi] to slc[ks[i]] for each i,
+// where ks are ascending. It recurses only into ranges that contain requested
+// ranks. Assumes lo ≤ ks[i] ≤ hi.
+func multi(lsw Lesswap, lo, hi int, ks []int, depth int, sv *syncVar) {
+	for len(ks) > 1 {
+		if hi-lo < sv.rec {
+			if hi-lo >= sv.ins {
+				short(lsw, lo, hi, depth, sv)
+			} else {
+				insertion(lsw, lo, hi)
+			}
+			return
+		}
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heap(lsw, lo, hi)
+			return
+		}
+
+		var l, h int
+		if hi-lo > 2*sv.rec && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partCon(lsw, lo, hi, sv) // concurrent dual partitioning
+			h = l - 1
+		} else {
+			pv, dup := pivot(lsw, lo, hi, nsLong-1) // median-of-n pivot
+
+			if dup { // members equal to pivot are in slc[l..h]
+				l, h = partEq(lsw, lo, pv, hi)
+			} else {
+				l = partOne(lsw, lo+1, pv, hi-1)
+				h = l - 1
+			}
+		}
+
+		sv.partStat(l-lo, hi-h, depth)
+
+		// split ranks as per partitioning
+		i := 0
+		for i < len(ks) && ks[i] < l {
+			i++
+		}
+		j := i
+		for j < len(ks) && ks[j] <= h {
+			j++
+		}
+		if i > 0 {
+			multi(lsw, lo, l-1, ks[:i], depth, sv)
+		}
+		lo, ks = h+1, ks[j:]
+	}
+
+	if len(ks) > 0 {
+		sel(lsw, lo, hi, ks[0], sv)
+	}
+}
 
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
+// partial concurrently sorts k smallest members of underlying collection
+// of length n to its first k positions via lsw().
+//
+//go:nosplit
+func partial(n, k int, lsw Lesswap, sv *syncVar) {
+	if k <= 0 {
+		return
+	}
+	lsw = sv.count(lsw) // statistics, if collected
+	if k < n {
+		sel(lsw, 0, n-1, k, sv)
+		n = k
 	}
+	sortLw(n, lsw, sv)
+}
+
+// Sort concurrently sorts underlying collection of length n via lsw().
+// Once for each non-trivial type you want to sort in a certain way, you
+// can implement a custom sorting routine (for a slice for example) as:
+//
+//	func SortTypeAscending(slc []Type) {
+//		lsw := func(i, k, r, s int) bool {
+//			if slc[i].Key < slc[k].Key { // strict comparator like < or >
+//				if r != s {
+//					slc[r], slc[s] = slc[s], slc[r]
+//				}
+//				return true
+//			}
+//			return false
+//		}
+//		sorty.Sort(len(slc), lsw)
+//	}
+//
+// [Lesswap] is a contract between users and sorty. Strict
+// comparator, r!=s check, swap and returns are all necessary.
+//
+//go:nosplit
+func Sort(n int, lsw Lesswap) {
+	sortLw(n, lsw, std.newVar(true))
+}
+
+// SortContext is like [Sort]() but can be canceled via ctx. Sorting goroutines stop
+// promptly when ctx is done, and it returns ctx.Err() after they all stop. A non-nil
+// result means the collection may not be sorted, but lsw() only swapped its elements.
+//
+//go:nosplit
+func SortContext(ctx context.Context, n int, lsw Lesswap) error {
+	sv := std.newVar(true)
+	sv.setCtx(ctx)
+	sortLw(n, lsw, sv)
+	return ctx.Err()
 }
@@ -0,0 +1,55 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import "reflect"
+
+// pairSK returns false for unrecognized kinds
+func pairSK(keys any, pl []any, srt *Sorter) bool {
+	slc, kind := extractSK(keys)
+	switch kind {
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float32,
+		reflect.Float64, reflect.String, sliceBias + reflect.Uint8:
+	default:
+		return false
+	}
+	perm := identity(slc.Len)
+	mv := []func(i int){moverAny(keys, perm)}
+	for _, p := range pl {
+		f := moverAny(p, perm)
+		if f == nil {
+			panic("sorty: SortPairs: payloads must be slices of same length as keys")
+		}
+		mv = append(mv, f)
+	}
+
+	// sort indices natively, then move keys & payloads along cycles of perm. sorting
+	// ends its goroutine counter, so moving needs new per-call variables.
+	argKind(slc, kind, perm, srt.kindVar(sliceKind(kind)))
+	forCycles(perm, func(i int) {
+		for _, f := range mv {
+			f(i)
+		}
+	}, srt.newVar(false))
+	return true
+}
+
+// SortPairs concurrently sorts keys in ascending order and moves members of each
+// payload slice in lockstep with their keys, like row ids or other columns of a
+// table. keys' type can be as in [SortSlice](), otherwise it panics. payloads can be
+// slices of any type, it panics if any of them is not a slice of len(keys). Keys are
+// compared natively, NaNs are handled as per [NaNoption]. Keys are sorted together
+// with their indices in a buffer like [ArgSortSlice](), then keys & payloads are moved along
+// cycles of the sorting permutation. Common slice types are moved natively, others
+// via reflection. Sorting is stable.
+//
+//go:nosplit
+func SortPairs(keys any, payloads ...any) {
+	if !pairSK(keys, payloads, std) {
+		panic("sorty: SortPairs: invalid input type")
+	}
+}
@@ -0,0 +1,208 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// min permutation length per goroutine for applying cycles concurrently
+const permMin = 1 << 14
+
+// cycles returns one member of each cycle of perm that is longer than one.
+// It panics if perm is not a permutation of [0,len(perm)).
+func cycles(perm []int) []int {
+	seen := make([]uint64, (len(perm)+63)>>6)
+	var lead []int
+	for i, k := range perm {
+		if seen[i>>6]&(1<<(i&63)) != 0 {
+			continue
+		}
+		if k == i {
+			continue // fixed point
+		}
+		lead = append(lead, i)
+
+		for j := i; ; {
+			seen[j>>6] |= 1 << (j & 63)
+			k = perm[j]
+			if uint(k) >= uint(len(perm)) {
+				panic("sorty: invalid permutation")
+			}
+			if k == i {
+				break
+			}
+			if seen[k>>6]&(1<<(k&63)) != 0 {
+				panic("sorty: invalid permutation") // k has two preimages
+			}
+			j = k
+		}
+	}
+	return lead
+}
+
+// swapCycle applies cycle of perm that contains i via swap()
+func swapCycle(perm []int, i int, swap func(i, k int)) {
+	for j, k := i, perm[i]; k != i; j, k = k, perm[k] {
+		swap(j, k)
+	}
+}
+
+// run f on each leader from next until done or canceled
+func cycleWork(lead []int, next *uint64, f func(i int), sv *syncVar) {
+	for !canceled(sv) {
+		c := atomic.AddUint64(next, 1) - 1
+		if c >= uint64(len(lead)) {
+			break
+		}
+		f(lead[c])
+	}
+}
+
+// new-goroutine cycle work
+func gCycleWork(lead []int, next *uint64, f func(i int), sv *syncVar, ch chan int) {
+	defer gEnd(sv, ch)
+	cycleWork(lead, next, f, sv)
+}
+
+// forCycles concurrently runs f on each cycle of perm longer than one, which is
+// identified by any one of its members. Cycles are independent of each other.
+func forCycles(perm []int, f func(i int), sv *syncVar) {
+	lead := cycles(perm)
+	n := len(perm) // at most one goroutine per cycle
+	if n > len(lead)*permMin {
+		n = len(lead) * permMin
+	}
+	g := numGor(n, permMin, sv)
+	var next uint64 // next leader to process
+	if g == 1 {
+		cycleWork(lead, &next, f, sv)
+		return
+	}
+
+	ch := make(chan int)
+	for c := g - 1; c > 0; c-- {
+		go gCycleWork(lead, &next, f, sv, ch)
+	}
+	defer sv.join(g, ch) // wait for goroutines, propagate panics
+	cycleWork(lead, &next, f, sv)
+}
+
+// mover returns a function that moves ar[perm[j]] to ar[j] for all j on the cycle
+// of perm that contains i
+func mover[T any](ar []T, perm []int) func(i int) {
+	return func(i int) {
+		tmp, j := ar[i], i
+		for k := perm[i]; k != i; j, k = k, perm[k] {
+			ar[j] = ar[k]
+		}
+		ar[j] = tmp
+	}
+}
+
+// moverAny returns a mover for slice ar, which is typed for common slice types and
+// reflect based otherwise. Returns nil if ar is not a slice of len(perm).
+func moverAny(ar any, perm []int) func(i int) {
+	var n int
+	var f func(i int)
+	switch a := ar.(type) {
+	case []int:
+		n, f = len(a), mover(a, perm)
+	case []int32:
+		n, f = len(a), mover(a, perm)
+	case []int64:
+		n, f = len(a), mover(a, perm)
+	case []uint32:
+		n, f = len(a), mover(a, perm)
+	case []uint64:
+		n, f = len(a), mover(a, perm)
+	case []float32:
+		n, f = len(a), mover(a, perm)
+	case []float64:
+		n, f = len(a), mover(a, perm)
+	case []string:
+		n, f = len(a), mover(a, perm)
+	case [][]byte:
+		n, f = len(a), mover(a, perm)
+	case []any:
+		n, f = len(a), mover(a, perm)
+	default:
+		v := reflect.ValueOf(ar)
+		if v.Kind() != reflect.Slice {
+			return nil
+		}
+		// reflect.Swapper() is not safe for concurrent use, so each cycle
+		// gets its own temporary
+		n, f = v.Len(), func(i int) {
+			tmp, j := reflect.New(v.Type().Elem()).Elem(), i
+			tmp.Set(v.Index(i))
+			for k := perm[i]; k != i; j, k = k, perm[k] {
+				v.Index(j).Set(v.Index(k))
+			}
+			v.Index(j).Set(tmp)
+		}
+	}
+	if n != len(perm) {
+		return nil
+	}
+	return f
+}
+
+// applyOf moves ar[perm[i]] to ar[i] for all i
+func applyOf[T any](ar []T, perm []int, sv *syncVar) {
+	forCycles(perm, mover(ar, perm), sv)
+}
+
+// ApplyPermutationSwap reorders underlying collection of length len(perm) in-place
+// via swap(), so that new member i is old member perm[i], like sorting it if perm
+// is from [ArgSort](). Cycles of perm are followed concurrently with up to [MaxGor]
+// goroutines, so swap() must be safe for concurrent use on distinct indices. perm
+// is not modified. It panics if perm is not a permutation of [0,len(perm)).
+func ApplyPermutationSwap(perm []int, swap func(i, k int)) {
+	forCycles(perm, func(i int) { swapCycle(perm, i, swap) }, std.newVar(false))
+}
+
+// applyAny reorders slice ar via perm, returns false if ar is not a slice of len(perm)
+func applyAny(ar any, perm []int, sv *syncVar) bool {
+	f := moverAny(ar, perm)
+	if f == nil {
+		return false
+	}
+	forCycles(perm, f, sv)
+	return true
+}
+
+// ApplyPermutation is like [ApplyPermutationSwap]() for slice ar of any type.
+// It panics if ar is not a slice of len(perm).
+func ApplyPermutation(ar any, perm []int) {
+	if !applyAny(ar, perm, std.newVar(false)) {
+		panic("sorty: ApplyPermutation: ar must be a slice of len(perm)")
+	}
+}
+
+// ApplyPermutationOf is the type-checked version of [ApplyPermutation](), which
+// moves members instead of swapping them. It panics if len(ar) ≠ len(perm).
+func ApplyPermutationOf[T any](ar []T, perm []int) {
+	if len(ar) != len(perm) {
+		panic("sorty: ApplyPermutationOf: len(ar) ≠ len(perm)")
+	}
+	applyOf(ar, perm, std.newVar(false))
+}
+
+// InvertPermutation inverts perm in-place, so that perm[k] = i if perm[i] = k
+// before the call. Cycles of perm are followed concurrently with up to [MaxGor]
+// goroutines. It panics if perm is not a permutation of [0,len(perm)).
+func InvertPermutation(perm []int) {
+	forCycles(perm, func(i int) {
+		j, k := i, perm[i]
+		for k != i {
+			perm[k], j, k = j, k, perm[k]
+		}
+		perm[i] = j
+	}, std.newVar(false))
+}
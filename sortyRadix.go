@@ -0,0 +1,422 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/jfcg/sixb"
+)
+
+// min slice length per goroutine in radix passes
+const radixMin = 1 << 15
+
+// radix counters of a chunk, 8 bits per pass
+type radixCnt [256]int
+
+// number of goroutines for processing n elements with at least min elements
+// per goroutine, at least 1. Its helpers are drawn from budget and added to
+// goroutine counters, so the caller must decrease them when helpers are done.
+//
+//go:norace
+func numGor(n, min int, sv *syncVar) int {
+	g := n / min
+	if g > 1 { // evaluates AutoGor only if helpers are possible
+		if mg := sv.maxG(); uint64(g) > mg {
+			g = int(mg)
+		}
+	}
+	if b := sv.budget; b != nil { // at most free helpers
+		free := 0
+		if b.used < b.Max {
+			free = int(b.Max - b.used)
+		}
+		if g > free+1 {
+			g = free + 1
+		}
+	}
+	for ; g > 1; g-- { // free helpers may be drawn by others meanwhile
+		if addGor(sv, uint64(g-1)) {
+			return g
+		}
+	}
+	return 1
+}
+
+// count digits of slc in cnt
+//
+//go:nosplit
+func countU4(slc []uint32, sh uint, cnt *radixCnt, ch chan int) {
+	*cnt = radixCnt{}
+	for _, x := range slc {
+		cnt[x>>sh&255]++
+	}
+	if ch != nil {
+		ch <- 0
+	}
+}
+
+// scatter slc into buf as per digit offsets
+//
+//go:nosplit
+func scatterU4(slc, buf []uint32, sh uint, off *radixCnt, ch chan int) {
+	for _, x := range slc {
+		d := x >> sh & 255
+		buf[off[d]] = x
+		off[d]++
+	}
+	if ch != nil {
+		ch <- 0
+	}
+}
+
+// radixU4 sorts slc via buf (of same length) with g goroutines, returns
+// number of completed passes. Result is in buf if it is odd.
+//
+//go:nosplit
+func radixU4(slc, buf []uint32, g int) (passes int) {
+	cnt := make([]radixCnt, g)
+	var ch chan int
+	if g > 1 {
+		ch = make(chan int)
+	}
+
+	for sh := uint(0); sh < 32; sh += 8 {
+		for c := g - 1; c > 0; c-- {
+			go countU4(slc[c*len(slc)/g:(c+1)*len(slc)/g], sh, &cnt[c], ch)
+		}
+		countU4(slc[:len(slc)/g], sh, &cnt[0], nil)
+		for c := g - 1; c > 0; c-- {
+			<-ch
+		}
+
+		// skip pass if all digits are equal
+		k, d := 0, slc[0]>>sh&255
+		for c := 0; c < g; c++ {
+			k += cnt[c][d]
+		}
+		if k == len(slc) {
+			continue
+		}
+
+		// digit offsets for each chunk
+		for off, d := 0, 0; d < 256; d++ {
+			for c := 0; c < g; c++ {
+				k = cnt[c][d]
+				cnt[c][d] = off
+				off += k
+			}
+		}
+
+		for c := g - 1; c > 0; c-- {
+			go scatterU4(slc[c*len(slc)/g:(c+1)*len(slc)/g], buf, sh, &cnt[c], ch)
+		}
+		scatterU4(slc[:len(slc)/g], buf, sh, &cnt[0], nil)
+		for c := g - 1; c > 0; c-- {
+			<-ch
+		}
+		slc, buf = buf, slc
+		passes++
+	}
+	return
+}
+
+// count digits of slc in cnt
+//
+//go:nosplit
+func countU8(slc []uint64, sh uint, cnt *radixCnt, ch chan int) {
+	*cnt = radixCnt{}
+	for _, x := range slc {
+		cnt[x>>sh&255]++
+	}
+	if ch != nil {
+		ch <- 0
+	}
+}
+
+// scatter slc into buf as per digit offsets
+//
+//go:nosplit
+func scatterU8(slc, buf []uint64, sh uint, off *radixCnt, ch chan int) {
+	for _, x := range slc {
+		d := x >> sh & 255
+		buf[off[d]] = x
+		off[d]++
+	}
+	if ch != nil {
+		ch <- 0
+	}
+}
+
+// radixU8 sorts slc via buf (of same length) with g goroutines, returns
+// number of completed passes. Result is in buf if it is odd.
+//
+//go:nosplit
+func radixU8(slc, buf []uint64, g int) (passes int) {
+	cnt := make([]radixCnt, g)
+	var ch chan int
+	if g > 1 {
+		ch = make(chan int)
+	}
+
+	for sh := uint(0); sh < 64; sh += 8 {
+		for c := g - 1; c > 0; c-- {
+			go countU8(slc[c*len(slc)/g:(c+1)*len(slc)/g], sh, &cnt[c], ch)
+		}
+		countU8(slc[:len(slc)/g], sh, &cnt[0], nil)
+		for c := g - 1; c > 0; c-- {
+			<-ch
+		}
+
+		// skip pass if all digits are equal
+		k, d := 0, slc[0]>>sh&255
+		for c := 0; c < g; c++ {
+			k += cnt[c][d]
+		}
+		if k == len(slc) {
+			continue
+		}
+
+		// digit offsets for each chunk
+		for off, d := 0, 0; d < 256; d++ {
+			for c := 0; c < g; c++ {
+				k = cnt[c][d]
+				cnt[c][d] = off
+				off += k
+			}
+		}
+
+		for c := g - 1; c > 0; c-- {
+			go scatterU8(slc[c*len(slc)/g:(c+1)*len(slc)/g], buf, sh, &cnt[c], ch)
+		}
+		scatterU8(slc[:len(slc)/g], buf, sh, &cnt[0], nil)
+		for c := g - 1; c > 0; c-- {
+			<-ch
+		}
+		slc, buf = buf, slc
+		passes++
+	}
+	return
+}
+
+// sortRadixU4 sorts 32-bit kinds: flip is the sign bit for signed kinds. Keys are
+// mapped to ordered unsigned keys and back, NaNs are handled as per sv.nan.
+//
+//go:nosplit
+func sortRadixU4(slc []uint32, flip uint32, float bool, sv *syncVar) {
+	if float {
+		slc = nanU4(slc, sv.nan)
+	}
+	if len(slc) < 2 {
+		return
+	}
+	for i, x := range slc {
+		if float && x>>31 != 0 {
+			x = ^x
+		} else {
+			x ^= flip
+		}
+		slc[i] = x
+	}
+
+	g := numGor(len(slc), radixMin, sv) // increases goroutine counters
+
+	buf := make([]uint32, len(slc))
+	if radixU4(slc, buf, g)&1 != 0 {
+		copy(slc, buf)
+	}
+
+	subGor(sv, uint64(g-1)) // decrease goroutine counters
+
+	for i, x := range slc {
+		if float && x>>31 == 0 {
+			x = ^x
+		} else {
+			x ^= flip
+		}
+		slc[i] = x
+	}
+}
+
+// sortRadixU8 sorts 64-bit kinds: flip is the sign bit for signed kinds. Keys are
+// mapped to ordered unsigned keys and back, NaNs are handled as per sv.nan.
+//
+//go:nosplit
+func sortRadixU8(slc []uint64, flip uint64, float bool, sv *syncVar) {
+	if float {
+		slc = nanU8(slc, sv.nan)
+	}
+	if len(slc) < 2 {
+		return
+	}
+	for i, x := range slc {
+		if float && x>>63 != 0 {
+			x = ^x
+		} else {
+			x ^= flip
+		}
+		slc[i] = x
+	}
+
+	g := numGor(len(slc), radixMin, sv) // increases goroutine counters
+
+	buf := make([]uint64, len(slc))
+	if radixU8(slc, buf, g)&1 != 0 {
+		copy(slc, buf)
+	}
+
+	subGor(sv, uint64(g-1)) // decrease goroutine counters
+
+	for i, x := range slc {
+		if float && x>>63 == 0 {
+			x = ^x
+		} else {
+			x ^= flip
+		}
+		slc[i] = x
+	}
+}
+
+// nanU4 moves float32 NaNs to the end (NaNlarge) or to the start (NaNsmall)
+// of slc, returns the rest. NaNs are radix sorted like other values for NaNignore.
+//
+//go:nosplit
+func nanU4(slc []uint32, nan FloatOption) []uint32 {
+	const inf = 0xff << 23
+	l, h := 0, len(slc)-1
+	if nan == NaNlarge {
+		for l <= h {
+			x := slc[h]
+			if x&^(1<<31) > inf {
+				h--
+				continue
+			}
+			y := slc[l]
+			if y&^(1<<31) > inf {
+				slc[l], slc[h] = x, y
+				h--
+			}
+			l++
+		}
+		return slc[:h+1]
+	}
+	if nan == NaNsmall {
+		for l <= h {
+			y := slc[l]
+			if y&^(1<<31) > inf {
+				l++
+				continue
+			}
+			x := slc[h]
+			if x&^(1<<31) > inf {
+				slc[l], slc[h] = x, y
+				l++
+			}
+			h--
+		}
+		return slc[l:]
+	}
+	return slc
+}
+
+// nanU8 moves float64 NaNs to the end (NaNlarge) or to the start (NaNsmall)
+// of slc, returns the rest. NaNs are radix sorted like other values for NaNignore.
+//
+//go:nosplit
+func nanU8(slc []uint64, nan FloatOption) []uint64 {
+	const inf = 0x7ff << 52
+	l, h := 0, len(slc)-1
+	if nan == NaNlarge {
+		for l <= h {
+			x := slc[h]
+			if x&^(1<<63) > inf {
+				h--
+				continue
+			}
+			y := slc[l]
+			if y&^(1<<63) > inf {
+				slc[l], slc[h] = x, y
+				h--
+			}
+			l++
+		}
+		return slc[:h+1]
+	}
+	if nan == NaNsmall {
+		for l <= h {
+			y := slc[l]
+			if y&^(1<<63) > inf {
+				l++
+				continue
+			}
+			x := slc[h]
+			if x&^(1<<63) > inf {
+				slc[l], slc[h] = x, y
+				l++
+			}
+			h--
+		}
+		return slc[l:]
+	}
+	return slc
+}
+
+// radixSK returns false for unrecognized kinds
+//
+//go:nosplit
+func radixSK(slc sixb.Slice, kind reflect.Kind, srt *Sorter) bool {
+	var flip uint64 // sign bit of signed kinds
+	switch kind {
+	case reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		flip = 1 << 63
+	case reflect.Uint32, reflect.Uint64:
+	default:
+		return false
+	}
+	float := kind == reflect.Float32 || kind == reflect.Float64
+	sv := srt.newVar(false)
+
+	if kind == reflect.Int32 || kind == reflect.Uint32 || kind == reflect.Float32 {
+		u := *(*[]uint32)(unsafe.Pointer(&slc))
+		sortRadixU4(u, uint32(flip>>32), float, sv)
+	} else {
+		u := *(*[]uint64)(unsafe.Pointer(&slc))
+		sortRadixU8(u, flip, float, sv)
+	}
+	sv.phase(sortPhase)
+	return true
+}
+
+// isPtrSlice returns true if ar is a pointer slice, inlined
+func isPtrSlice(ar any) bool {
+	tipe := reflect.TypeOf(ar)
+	if tipe == nil || tipe.Kind() != reflect.Slice {
+		return false
+	}
+	k := tipe.Elem().Kind()
+	return k == reflect.Pointer || k == reflect.UnsafePointer
+}
+
+// SortSliceRadix sorts ar in ascending order via parallel LSD radix sort, which is
+// usually faster than [SortSlice]() on large inputs. ar's (underlying) type can be
+//
+//	[]int, []int32, []int64, []uint, []uint32, []uint64,
+//	[]uintptr, []float32, []float64
+//
+// otherwise it panics. NaNs are handled as per [NaNoption]. Unlike other Sort*()
+// calls, it is not in-place: it allocates a buffer of len(ar) elements and 2 KiB
+// counters per goroutine. It uses up to [MaxGor] goroutines for each pass over
+// 8-bit digits, and skips passes where all digits are equal.
+//
+//go:nosplit
+func SortSliceRadix(ar any) {
+	slc, kind := extractSK(ar)
+	if isPtrSlice(ar) || !radixSK(slc, kind, std) {
+		panic("sorty: SortSliceRadix: invalid input type")
+	}
+}
@@ -6,11 +6,7 @@
 
 package sorty
 
-import (
-	"sync/atomic"
-
-	"github.com/jfcg/sixb"
-)
+import "github.com/jfcg/sixb"
 
 // isSortedS returns 0 if ar is sorted in ascending lexicographic
 // order, otherwise it returns i > 0 with ar[i] < ar[i-1], inlined
@@ -48,12 +44,100 @@ func insertionS(slc []string) {
 	}
 }
 
+// heapS sorts slc in ascending order via heapsort, which is used when
+// partitioning budget is exhausted. It guarantees O(n·log n) time.
+//
+//go:nosplit
+func heapS(slc []string) {
+	for i := len(slc)>>1 - 1; i >= 0; i-- {
+		siftS(slc, i, len(slc))
+	}
+	for n := len(slc) - 1; n > 0; n-- {
+		slc[0], slc[n] = slc[n], slc[0]
+		siftS(slc, 0, n)
+	}
+}
+
+// siftS moves slc[root] down in heap slc[:n], inlined
+func siftS(slc []string, root, n int) {
+	val := slc[root]
+	for c := 2*root + 1; c < n; c = 2*c + 1 {
+		top := slc[c]
+		if c+1 < n {
+			if nxt := slc[c+1]; top < nxt {
+				top = nxt
+				c++
+			}
+		}
+		if val >= top {
+			break
+		}
+		slc[root] = top
+		root = c
+	}
+	slc[root] = val
+}
+
+// runS tries to finish slc in linear time if its samples are in (reverse) order.
+// slc is reversed if it is in reverse order, or insertion sorted if it has at most
+// nsLong misplaced members, each within maxShift of its place. Returns true if
+// slc is sorted.
+//
+//go:nosplit
+func runS(slc []string) bool {
+	first, step, last := minMaxSample(uint(len(slc)), nsLong)
+	fwd, rev := true, true
+	for i := first + step; i <= last; i += step {
+		if slc[i] < slc[i-step] {
+			fwd = false
+		} else if slc[i-step] < slc[i] {
+			rev = false
+		}
+	}
+
+	if !fwd {
+		if !rev {
+			return false // no presorted run
+		}
+		for i := len(slc) - 1; i > 0; i-- {
+			if slc[i-1] < slc[i] {
+				return false
+			}
+		}
+		for l, h := 0, len(slc)-1; l < h; l, h = l+1, h-1 {
+			slc[l], slc[h] = slc[h], slc[l]
+		}
+		return true
+	}
+
+	for h, n := 1, nsLong; h < len(slc); h++ {
+		val := slc[h]
+		if val >= slc[h-1] {
+			continue
+		}
+		if n--; n < 0 {
+			return false // too many misplaced members
+		}
+		l := h
+		for ; l > 0 && val < slc[l-1]; l-- {
+			if h-l >= maxShift {
+				slc[l] = val
+				return false // too long shift
+			}
+			slc[l] = slc[l-1]
+		}
+		slc[l] = val
+	}
+	return true
+}
+
 // pivotS selects n equidistant samples from slc that minimizes max distance
 // to non-selected members, then calculates median-of-n pivot from samples.
-// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning.
+// Assumes odd n, nsConc > n ≥ 3, len(slc) ≥ 2n. Returns pivot for partitioning
+// and whether samples show duplicates of it.
 //
 //go:nosplit
-func pivotS(slc []string, n uint) string {
+func pivotS(slc []string, n uint) (string, bool) {
 
 	first, step, _ := minMaxSample(uint(len(slc)), n)
 
@@ -64,7 +148,8 @@ func pivotS(slc []string, n uint) string {
 	}
 	insertionS(sample[:n]) // sort n samples
 
-	return sample[n>>1] // return middle sample
+	n >>= 1 // return middle sample, equal to a neighbor if duplicates
+	return sample[n], sample[n] == sample[n-1] || sample[n] == sample[n+1]
 }
 
 // partition slc, returns k with slc[:k] ≤ pivot ≤ slc[k:]
@@ -171,27 +256,62 @@ start:
 	}
 }
 
+// partEqS partitions slc into slc[:l] < pv, slc[l:h] = pv, slc[h:] > pv
+// (Dutch national flag), so members equal to pivot are excluded from recursion.
+//
+//go:nosplit
+func partEqS(slc []string, pv string) (l, h int) {
+	h = len(slc)
+	for m := 0; m < h; {
+		x := slc[m]
+		if x < pv {
+			slc[l], slc[m] = x, slc[l]
+			l++
+			m++
+		} else if pv < x {
+			h--
+			slc[m], slc[h] = slc[h], x
+		} else {
+			m++
+		}
+	}
+	return
+}
+
 // new-goroutine partition
 //
 //go:nosplit
-func gPartOneS(ar []string, pv string, ch chan int) {
-	ch <- partOneS(ar, pv)
+func gPartOneS(ar []string, pv string, sv *syncVar) {
+	r := gStart(sv, regionPart)
+	k := partOneS(ar, pv)
+	endRegion(r)
+	subGor(sv, 1) // decrease goroutine counters
+	sv.done <- k
 }
 
-// partition slc in two goroutines, returns k with slc[:k] ≤ pivot ≤ slc[k:]
+// partition slc in two goroutines via sv.done, returns k with slc[:k] ≤ pivot ≤ slc[k:]
 //
 //go:nosplit
-func partConS(slc []string, ch chan int) int {
+func partConS(slc []string, sv *syncVar) int {
 
-	pv := pivotS(slc, nsConc-1) // median-of-n pivot
+	pv, _ := pivotS(slc, nsConc-1) // median-of-n pivot
 	mid := len(slc) >> 1
 	l, h := mid>>1, sixb.MeanI(mid, len(slc))
 
-	go gPartOneS(slc[l:h:h], pv, ch) // mid half range
+	// mid half range in a new goroutine if budget allows
+	k := -1
+	if addGor(sv, 1) { // increase goroutine counters
+		go gPartOneS(slc[l:h:h], pv, sv)
+	} else {
+		k = partOneS(slc[l:h:h], pv)
+	}
 
 	r := partTwoS(slc, l, h, pv) // left/right quarter ranges
 
-	k := l + <-ch // convert returned index to slc
+	if k < 0 {
+		k = <-sv.done
+	}
+	k += l // convert returned index to slc
 
 	// only one gap is possible
 	if r < mid {
@@ -212,9 +332,16 @@ func partConS(slc []string, ch chan int) int {
 	return k
 }
 
-// short range sort function, assumes MaxLenInsFC < len(ar) <= MaxLenRecFC, recursive
-func shortS(ar []string) {
+// short range sort function, assumes sv.ins < len(ar) <= sv.rec, recursive
+func shortS(ar []string, depth int, sv *syncVar) {
 start:
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapS(ar)
+		return
+	}
 	first, step, last := minMaxSample(uint(len(ar)), 3)
 	f, pv, l := ar[first], ar[first+step], ar[last]
 
@@ -239,15 +366,16 @@ start:
 		aq = ar[k:]
 		ar = ar[:k:k]
 	}
+	sv.partStat(len(aq), len(ar), depth)
 
-	if len(aq) > MaxLenInsFC {
-		shortS(aq) // recurse on the shorter range
+	if len(aq) > sv.ins {
+		shortS(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 isort:
 	insertionS(aq) // at least one insertion range
 
-	if len(ar) > MaxLenInsFC {
+	if len(ar) > sv.ins {
 		goto start
 	}
 	if &ar[0] != &aq[0] {
@@ -259,80 +387,126 @@ isort:
 // new-goroutine sort function
 //
 //go:nosplit
-func gLongS(ar []string, sv *syncVar) {
-	longS(ar, sv)
-
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) == 0 { // decrease goroutine counter
-		sv.done <- 0 // we are the last, all done
-	}
+func gLongS(ar []string, depth int, sv *syncVar) {
+	defer gEnd(sv, nil)
+	defer endRegion(gStart(sv, regionSort))
+	longS(ar, depth, sv)
 }
 
-// long range sort function, assumes len(ar) > MaxLenRecFC, recursive
-func longS(ar []string, sv *syncVar) {
+// long range sort function, assumes len(ar) > sv.rec, recursive
+func longS(ar []string, depth int, sv *syncVar) {
+	if runS(ar) { // presorted?
+		return
+	}
 start:
-	pv := pivotS(ar, nsLong-1) // median-of-n pivot
-	k := partOneS(ar, pv)
+	if canceled(sv) {
+		return
+	}
+	if depth--; depth < 0 { // partitioning budget exhausted?
+		heapS(ar)
+		return
+	}
+	pv, dup := pivotS(ar, nsLong-1) // median-of-n pivot
 	var aq []string
 
-	if k < len(ar)-k {
-		aq = ar[:k:k]
-		ar = ar[k:] // ar is the longer range
+	if dup { // exclude members equal to pivot from recursion
+		l, h := partEqS(ar, pv)
+		aq, ar = ar[:l:l], ar[h:]
+		if len(aq) > len(ar) {
+			aq, ar = ar, aq // ar is the longer range
+		}
+		sv.partStat(len(aq), len(ar), depth)
+
+		if len(ar) <= sv.rec { // two not-long ranges?
+			if len(aq) > sv.ins {
+				shortS(aq, depth, sv)
+			} else {
+				insertionS(aq)
+			}
+			if len(ar) > sv.ins {
+				shortS(ar, depth, sv)
+			} else {
+				insertionS(ar)
+			}
+			return
+		}
 	} else {
-		aq = ar[k:]
-		ar = ar[:k:k]
+		k := partOneS(ar, pv)
+
+		if k < len(ar)-k {
+			aq = ar[:k:k]
+			ar = ar[k:] // ar is the longer range
+		} else {
+			aq = ar[k:]
+			ar = ar[:k:k]
+		}
+		sv.partStat(len(aq), len(ar), depth)
 	}
 
 	// branches below are optimal for fewer total jumps
-	if len(aq) <= MaxLenRecFC { // at least one not-long range?
+	if len(aq) <= sv.rec { // at least one not-long range?
 
-		if len(aq) > MaxLenInsFC {
-			shortS(aq)
+		if len(aq) > sv.ins {
+			shortS(aq, depth, sv)
 		} else {
 			insertionS(aq)
 		}
 
-		if len(ar) > MaxLenRecFC { // two not-long ranges?
+		if len(ar) > sv.rec { // two not-long ranges?
 			goto start
 		}
-		shortS(ar) // we know len(ar) > MaxLenInsFC
+		shortS(ar, depth, sv) // we know len(ar) > sv.ins
 		return
 	}
 
-	// max goroutines? not atomic but good enough
-	if sv == nil || gorFull(sv) {
-		longS(aq, sv) // recurse on the shorter range
+	// max goroutines? not atomic but good enough. budget? increase goroutine
+	// counters only if it allows
+	if gorFull(sv) || !addGor(sv, 1) {
+		longS(aq, depth, sv) // recurse on the shorter range
 		goto start
 	}
 
 	// new-goroutine sort on the longer range only when
 	// both ranges are big and max goroutines is not exceeded
-	atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-	go gLongS(ar, sv)
+	go gLongS(ar, depth, sv)
 	ar = aq
 	goto start
 }
 
 // sortS concurrently sorts ar in ascending lexicographic order.
-func sortS(ar []string) {
+func sortS(ar []string, sv *syncVar) {
 
-	if len(ar) < 2*(MaxLenRecFC+1) || MaxGor <= 1 {
+	depth := maxDepth(len(ar)) // partitioning budget
+	if len(ar) < 2*(sv.rec+1) || gorFull(sv) {
+		mg, b := single(sv) // stay single-goroutine
+		sv.enter(regionSort)
 
-		if len(ar) > MaxLenRecFC { // single-goroutine sorting
-			longS(ar, nil)
-		} else if len(ar) > MaxLenInsFC {
-			shortS(ar)
+		if len(ar) > sv.rec { // single-goroutine sorting
+			longS(ar, depth, sv)
+		} else if len(ar) > sv.ins {
+			shortS(ar, depth, sv)
 		} else {
 			insertionS(ar)
 		}
+		sv.leave()
+		sv.maxGor, sv.budget = mg, b
+		sv.phase(sortPhase)
+		return
+	}
+
+	if runS(ar) { // presorted?
 		return
 	}
 
 	// create channel only when concurrent partitioning & sorting
-	sv := syncVar{1, // number of goroutines including this
-		make(chan int)} // end signal
+	sv.done = make(chan int) // end signal
+	defer sv.quit()          // wait for goroutines, propagate panics
+	sv.newTask()             // trace concurrent sorting, if enabled
+	sv.enter(regionPart)
 	for {
 		// concurrent dual partitioning with done
-		k := partConS(ar, sv.done)
+		k := partConS(ar, sv)
+		depth--
 		var aq []string
 
 		if k < len(ar)-k {
@@ -342,28 +516,155 @@ func sortS(ar []string) {
 			aq = ar[k:]
 			ar = ar[:k:k]
 		}
+		sv.partStat(len(aq), len(ar), depth)
 
 		// handle shorter range
-		if len(aq) > MaxLenRecFC {
-			atomic.AddUint64(&sv.nGor, 1) // increase goroutine counter
-			go gLongS(aq, &sv)
-
-		} else if len(aq) > MaxLenInsFC {
-			shortS(aq)
+		if len(aq) > sv.rec {
+			if addGor(sv, 1) { // increase goroutine counters
+				go gLongS(aq, depth, sv)
+			} else {
+				longS(aq, depth, sv) // budget is full
+			}
+		} else if len(aq) > sv.ins {
+			shortS(aq, depth, sv)
 		} else {
 			insertionS(aq)
 		}
 
-		// longer range big enough? max goroutines?
-		if len(ar) < 2*(MaxLenRecFC+1) || gorFull(&sv) {
+		// longer range big enough? max goroutines? canceled? budget?
+		if len(ar) < 2*(sv.rec+1) || gorFull(sv) || canceled(sv) || depth <= 0 {
 			break
 		}
 		// dual partition longer range
 	}
 
-	longS(ar, &sv) // we know len(ar) > MaxLenRecFC
+	sv.leave()
+	sv.phase(partPhase)
+	sv.enter(regionSort)
+	longS(ar, depth, sv) // we know len(ar) > sv.rec
+	sv.leave()
+}
+
+// selectS moves k-th smallest member of ar to ar[k], so that
+// ar[:k] ≤ ar[k] ≤ ar[k+1:]. It recurses only into the range that contains k.
+// Assumes 0 ≤ k < len(ar).
+func selectS(ar []string, k int, sv *syncVar) {
+	depth := maxDepth(len(ar)) // partitioning budget
+	for len(ar) > sv.rec {
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapS(ar)
+			return
+		}
+
+		var m int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			m = partConS(ar, sv) // concurrent dual partitioning
+		} else {
+			pv, dup := pivotS(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // exclude members equal to pivot
+				l, h := partEqS(ar, pv)
+				sv.partStat(l, len(ar)-h, depth)
+				if k < l {
+					ar = ar[:l]
+				} else if k < h {
+					return // ar[k] = pivot
+				} else {
+					ar = ar[h:]
+					k -= h
+				}
+				continue
+			}
+			m = partOneS(ar, pv)
+		}
+
+		sv.partStat(m, len(ar)-m, depth)
+		if k < m {
+			ar = ar[:m]
+		} else {
+			ar = ar[m:]
+			k -= m
+		}
+	}
+
+	if len(ar) > sv.ins {
+		shortS(ar, depth, sv)
+	} else {
+		insertionS(ar)
+	}
+}
+
+// multiS moves ks[i]-th smallest member to ar[ks[i]-off] for each i, where ks
+// are ascending ranks and ar starts at rank off. It recurses only into ranges
+// that contain requested ranks. Assumes off ≤ ks[i] < off+len(ar).
+func multiS(ar []string, ks []int, off, depth int, sv *syncVar) {
+	for len(ks) > 1 {
+		if len(ar) <= sv.rec {
+			if len(ar) > sv.ins {
+				shortS(ar, depth, sv)
+			} else {
+				insertionS(ar)
+			}
+			return
+		}
+		if depth--; depth < 0 { // partitioning budget exhausted?
+			heapS(ar)
+			return
+		}
+
+		var l, h int
+		if len(ar) >= 2*(sv.rec+1) && !gorFull(sv) {
+			if sv.done == nil {
+				sv.done = make(chan int) // end signal
+			}
+			l = partConS(ar, sv) // concurrent dual partitioning
+			h = l
+		} else {
+			pv, dup := pivotS(ar, nsLong-1) // median-of-n pivot
+
+			if dup { // members equal to pivot are in ar[l:h]
+				l, h = partEqS(ar, pv)
+			} else {
+				l = partOneS(ar, pv)
+				h = l
+			}
+		}
+
+		sv.partStat(l, len(ar)-h, depth)
+
+		// split ranks as per partitioning
+		i := 0
+		for i < len(ks) && ks[i]-off < l {
+			i++
+		}
+		j := i
+		for j < len(ks) && ks[j]-off < h {
+			j++
+		}
+		if i > 0 {
+			multiS(ar[:l], ks[:i], off, depth, sv)
+		}
+		ar, ks, off = ar[h:], ks[j:], off+h
+	}
+
+	if len(ks) > 0 {
+		selectS(ar, ks[0]-off, sv)
+	}
+}
 
-	if atomic.AddUint64(&sv.nGor, ^uint64(0)) != 0 { // decrease goroutine counter
-		<-sv.done // we are not the last, wait
+// partialS concurrently sorts k smallest members of ar to ar[:k].
+//
+//go:nosplit
+func partialS(ar []string, k int, sv *syncVar) {
+	if k <= 0 {
+		return
+	}
+	if k < len(ar) {
+		selectS(ar, k, sv)
+		ar = ar[:k]
 	}
+	sortS(ar, sv)
 }
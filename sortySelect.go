@@ -0,0 +1,248 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/jfcg/sixb"
+)
+
+// nanF4 moves NaNs to the end (NaNlarge) or to the start (NaNsmall) of f,
+// returns the rest and its start index in f, inlined
+func nanF4(f []float32, nan FloatOption) ([]float32, int) {
+	u := nanU4(*(*[]uint32)(unsafe.Pointer(&f)), nan)
+	l := 0
+	if nan == NaNsmall {
+		l = len(f) - len(u)
+	}
+	return f[l : l+len(u)], l
+}
+
+// nanF8 moves NaNs to the end (NaNlarge) or to the start (NaNsmall) of f,
+// returns the rest and its start index in f, inlined
+func nanF8(f []float64, nan FloatOption) ([]float64, int) {
+	u := nanU8(*(*[]uint64)(unsafe.Pointer(&f)), nan)
+	l := 0
+	if nan == NaNsmall {
+		l = len(f) - len(u)
+	}
+	return f[l : l+len(u)], l
+}
+
+// partialSK returns false for unrecognized kinds
+//
+//go:nosplit
+func partialSK(slc sixb.Slice, kind reflect.Kind, k int, srt *Sorter) bool {
+
+	sv := srt.kindVar(sliceKind(kind))
+
+	switch kind {
+	case reflect.Int32:
+		partialI4(*(*[]int32)(unsafe.Pointer(&slc)), k, sv)
+	case reflect.Int64:
+		partialI8(*(*[]int64)(unsafe.Pointer(&slc)), k, sv)
+	case reflect.Uint32:
+		partialU4(*(*[]uint32)(unsafe.Pointer(&slc)), k, sv)
+	case reflect.Uint64:
+		partialU8(*(*[]uint64)(unsafe.Pointer(&slc)), k, sv)
+	case reflect.Float32:
+		f, l := nanF4(*(*[]float32)(unsafe.Pointer(&slc)), sv.nan)
+		partialF4(f, k-l, sv)
+	case reflect.Float64:
+		f, l := nanF8(*(*[]float64)(unsafe.Pointer(&slc)), sv.nan)
+		partialF8(f, k-l, sv)
+	case sliceBias + reflect.Uint8: // [][]byte
+		partialB(*(*[][]byte)(unsafe.Pointer(&slc)), k, sv)
+	case reflect.String:
+		partialS(*(*[]string)(unsafe.Pointer(&slc)), k, sv)
+	default:
+		return false
+	}
+	return true
+}
+
+// PartialSortSlice concurrently sorts k smallest members of ar in ascending order
+// into ar[:k], rest of ar is left in no particular order. It is much faster than
+// [SortSlice]() for k ≪ len(ar), and k ≥ len(ar) sorts whole ar. ar's type can be
+// as in [SortSlice](), otherwise it panics.
+//
+//go:nosplit
+func PartialSortSlice(ar any, k int) {
+	slc, kind := extractSK(ar)
+	if !partialSK(slc, kind, k, std) {
+		panic("sorty: PartialSortSlice: invalid input type")
+	}
+}
+
+// PartialSort concurrently sorts k smallest members of underlying collection of
+// length n to its first k positions via lsw(), rest is left in no particular order.
+//
+//go:nosplit
+func PartialSort(n, k int, lsw Lesswap) {
+	partial(n, k, lsw, std.newVar(true))
+}
+
+// sortRanks returns ascending & distinct copy of ranks, panics if any is not in [0,n)
+func sortRanks(n int, ranks []int, srt *Sorter) []int {
+	ks := make([]int, len(ranks))
+	for i, k := range ranks {
+		if uint(k) >= uint(n) {
+			panic("sorty: rank out of range")
+		}
+		ks[i] = k
+	}
+	if srt != nil { // ranks are not collected or traced
+		c := *srt
+		c.Stats, c.Trace = nil, false
+		srt = &c
+	}
+	srt.SortSlice(ks)
+
+	i := 0
+	for _, k := range ks {
+		if i == 0 || ks[i-1] != k {
+			ks[i] = k
+			i++
+		}
+	}
+	return ks[:i]
+}
+
+// nanRanks returns ranks in [l,l+n) out of ascending ks, inlined
+func nanRanks(ks []int, l, n int) []int {
+	i := 0
+	for i < len(ks) && ks[i] < l {
+		i++
+	}
+	j := len(ks)
+	for j > i && ks[j-1] >= l+n {
+		j--
+	}
+	return ks[i:j]
+}
+
+// selectSK returns false for unrecognized kinds
+//
+//go:nosplit
+func selectSK(slc sixb.Slice, kind reflect.Kind, ranks []int, srt *Sorter) bool {
+	switch kind {
+	case reflect.Int32, reflect.Int64, reflect.Uint32, reflect.Uint64, reflect.Float32,
+		reflect.Float64, reflect.String, sliceBias + reflect.Uint8:
+	default:
+		return false
+	}
+	ks := sortRanks(slc.Len, ranks, srt)
+	if len(ks) == 0 {
+		return true
+	}
+	sv := srt.kindVar(sliceKind(kind))
+	depth := maxDepth(slc.Len) // partitioning budget
+
+	switch kind {
+	case reflect.Int32:
+		multiI4(*(*[]int32)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	case reflect.Int64:
+		multiI8(*(*[]int64)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	case reflect.Uint32:
+		multiU4(*(*[]uint32)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	case reflect.Uint64:
+		multiU8(*(*[]uint64)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	case reflect.Float32:
+		f, l := nanF4(*(*[]float32)(unsafe.Pointer(&slc)), sv.nan)
+		if ks = nanRanks(ks, l, len(f)); len(ks) > 0 {
+			multiF4(f, ks, l, depth, sv)
+		}
+	case reflect.Float64:
+		f, l := nanF8(*(*[]float64)(unsafe.Pointer(&slc)), sv.nan)
+		if ks = nanRanks(ks, l, len(f)); len(ks) > 0 {
+			multiF8(f, ks, l, depth, sv)
+		}
+	case sliceBias + reflect.Uint8: // [][]byte
+		multiB(*(*[][]byte)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	default: // reflect.String
+		multiS(*(*[]string)(unsafe.Pointer(&slc)), ks, 0, depth, sv)
+	}
+	sv.phase(sortPhase)
+	return true
+}
+
+// NthElementSlice concurrently moves k-th smallest member (counting from zero) of
+// ar to ar[k], so that ar[:k] ≤ ar[k] ≤ ar[k+1:] and ar[k] is as if ar was sorted.
+// It is much faster than [SortSlice]() since it only recurses into ranges that
+// contain k. ar's type can be as in [SortSlice](), otherwise it panics. It also
+// panics if k is not in [0,len(ar)). NaNs are handled as per [NaNoption].
+//
+//go:nosplit
+func NthElementSlice(ar any, k int) {
+	slc, kind := extractSK(ar)
+	if !selectSK(slc, kind, []int{k}, std) {
+		panic("sorty: NthElementSlice: invalid input type")
+	}
+}
+
+// NthElement concurrently moves k-th smallest member (counting from zero) of
+// underlying collection of length n to its k-th position via lsw(), so that
+// members before it are ≤ and members after it are ≥. It panics if k is not in [0,n).
+//
+//go:nosplit
+func NthElement(n, k int, lsw Lesswap) {
+	selectLw(n, lsw, []int{k}, std)
+}
+
+// SelectSlice concurrently moves each ranks[i]-th smallest member of ar to
+// ar[ranks[i]], as if ar was sorted. It partitions ar once per level and only
+// recurses into ranges that contain requested ranks, so it is much faster than
+// [SortSlice]() for a few ranks. ranks can be in any order and are not modified.
+// ar's type can be as in [SortSlice](), otherwise it panics. It also panics if any
+// rank is not in [0,len(ar)). NaNs are handled as per [NaNoption]. For example:
+//
+//	sorty.SelectSlice(latency, sorty.QuantileRanks(len(latency), 0.5, 0.9, 0.99)...)
+//
+//go:nosplit
+func SelectSlice(ar any, ranks ...int) {
+	slc, kind := extractSK(ar)
+	if !selectSK(slc, kind, ranks, std) {
+		panic("sorty: SelectSlice: invalid input type")
+	}
+}
+
+// selectLw concurrently moves each requested rank to its position via lsw()
+//
+//go:nosplit
+func selectLw(n int, lsw Lesswap, ranks []int, srt *Sorter) {
+	if ks := sortRanks(n, ranks, srt); len(ks) > 0 {
+		sv := srt.newVar(true)
+		multi(sv.count(lsw), 0, n-1, ks, maxDepth(n), sv)
+		sv.phase(sortPhase)
+	}
+}
+
+// Select is like [SelectSlice]() for underlying collection of length n via lsw().
+//
+//go:nosplit
+func Select(n int, lsw Lesswap, ranks ...int) {
+	selectLw(n, lsw, ranks, std)
+}
+
+// QuantileRanks returns nearest ranks of quantiles q (fractions in [0,1]) for
+// a collection of length n ≥ 1, to be used with [SelectSlice]() or [Select]().
+// It panics for invalid input.
+func QuantileRanks(n int, q ...float64) []int {
+	if n < 1 {
+		panic("sorty: QuantileRanks: n < 1")
+	}
+	ranks := make([]int, len(q))
+	for i, x := range q {
+		if !(0 <= x && x <= 1) { // also catches NaNs
+			panic("sorty: QuantileRanks: quantile not in [0,1]")
+		}
+		ranks[i] = int(x*float64(n-1) + 0.5)
+	}
+	return ranks
+}
@@ -7,88 +7,294 @@
 package sorty
 
 import (
+	"context"
 	"reflect"
 	"unsafe"
+
+	"github.com/jfcg/sixb"
 )
 
-// IsSortedSlice returns 0 if ar is sorted in ascending order, otherwise
-// it returns i > 0 with ar[i] < ar[i-1]. ar's (underlying) type can be
-//
-//	[]int, []int32, []int64, []uint, []uint32, []uint64,
-//	[]uintptr, []float32, []float64, []string, [][]byte,
-//	[]unsafe.Pointer, []*T // for any type T
+// Native is the set of element types [SortSliceOf]() and [IsSortedSliceOf]() accept.
+// Pointer slices are not expressible as a constraint, use [SortSlice]() for them.
+type Native interface {
+	~int | ~int32 | ~int64 | ~uint | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string | ~[]byte
+}
+
+// kindOf returns hardware element kind of T for predeclared types,
+// reflect.Invalid for named types, inlined
+func kindOf[T Native]() reflect.Kind {
+	var z T
+	switch any(z).(type) {
+	case int:
+		return intKind
+	case int32:
+		return reflect.Int32
+	case int64:
+		return reflect.Int64
+	case uint:
+		return uintKind
+	case uint32:
+		return reflect.Uint32
+	case uint64:
+		return reflect.Uint64
+	case uintptr:
+		return uptrKind
+	case float32:
+		return reflect.Float32
+	case float64:
+		return reflect.Float64
+	case string:
+		return reflect.String
+	case []byte:
+		return sliceBias + reflect.Uint8
+	}
+	return reflect.Invalid
+}
+
+// sliceOf converts ar to slice & element kind, reflection
+// is only used for named element types
 //
-// otherwise it panics.
+//go:nosplit
+func sliceOf[T Native](ar []T) (sixb.Slice, reflect.Kind) {
+	if kind := kindOf[T](); kind != reflect.Invalid {
+		return *(*sixb.Slice)(unsafe.Pointer(&ar)), kind
+	}
+	return extractSK(ar)
+}
+
+// isSortedSK returns -1 for unrecognized kinds
 //
 //go:nosplit
-func IsSortedSlice(ar any) int {
-	slc, kind := extractSK(ar)
+func isSortedSK(slc sixb.Slice, kind reflect.Kind, desc bool, nan FloatOption) int {
 	switch kind {
 	case reflect.Int32:
 		i := *(*[]int32)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescI4(i)
+		}
 		return isSortedI4(i)
 	case reflect.Int64:
 		i := *(*[]int64)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescI8(i)
+		}
 		return isSortedI8(i)
 	case reflect.Uint32:
 		u := *(*[]uint32)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescU4(u)
+		}
 		return isSortedU4(u)
 	case reflect.Uint64:
 		u := *(*[]uint64)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescU8(u)
+		}
 		return isSortedU8(u)
 	case reflect.Float32:
 		f := *(*[]float32)(unsafe.Pointer(&slc))
-		return isSortedF4(f)
+		if desc {
+			return isSortedDescF4(f, nan)
+		}
+		return isSortedF4(f, nan)
 	case reflect.Float64:
 		f := *(*[]float64)(unsafe.Pointer(&slc))
-		return isSortedF8(f)
+		if desc {
+			return isSortedDescF8(f, nan)
+		}
+		return isSortedF8(f, nan)
 	case sliceBias + reflect.Uint8: // [][]byte
 		b := *(*[][]byte)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescB(b)
+		}
 		return isSortedB(b)
 	case reflect.String:
 		s := *(*[]string)(unsafe.Pointer(&slc))
+		if desc {
+			return isSortedDescS(s)
+		}
 		return isSortedS(s)
 	}
-	panic("sorty: IsSortedSlice: invalid input type")
+	return -1
 }
 
-// SortSlice concurrently sorts ar in ascending order. ar's (underlying) type can be
-//
-//	[]int, []int32, []int64, []uint, []uint32, []uint64,
-//	[]uintptr, []float32, []float64, []string, [][]byte,
-//	[]unsafe.Pointer, []*T // for any type T
-//
-// otherwise it panics.
+// sortSK returns false for unrecognized kinds
 //
 //go:nosplit
-func SortSlice(ar any) {
-	slc, kind := extractSK(ar)
+func sortSK(slc sixb.Slice, kind reflect.Kind, desc bool, srt *Sorter,
+	ctx context.Context) bool {
+
+	sv := srt.kindVar(sliceKind(kind))
+	sv.setCtx(ctx) // nil for no cancellation
+
 	switch kind {
 	case reflect.Int32:
 		i := *(*[]int32)(unsafe.Pointer(&slc))
-		sortI4(i)
+		if desc {
+			sortDescI4(i, sv)
+		} else {
+			sortI4(i, sv)
+		}
 	case reflect.Int64:
 		i := *(*[]int64)(unsafe.Pointer(&slc))
-		sortI8(i)
+		if desc {
+			sortDescI8(i, sv)
+		} else {
+			sortI8(i, sv)
+		}
 	case reflect.Uint32:
 		u := *(*[]uint32)(unsafe.Pointer(&slc))
-		sortU4(u)
+		if desc {
+			sortDescU4(u, sv)
+		} else {
+			sortU4(u, sv)
+		}
 	case reflect.Uint64:
 		u := *(*[]uint64)(unsafe.Pointer(&slc))
-		sortU8(u)
+		if desc {
+			sortDescU8(u, sv)
+		} else {
+			sortU8(u, sv)
+		}
 	case reflect.Float32:
 		f := *(*[]float32)(unsafe.Pointer(&slc))
-		sortF4(f)
+		if desc {
+			sortDescF4(f, sv)
+		} else {
+			sortF4(f, sv)
+		}
 	case reflect.Float64:
 		f := *(*[]float64)(unsafe.Pointer(&slc))
-		sortF8(f)
+		if desc {
+			sortDescF8(f, sv)
+		} else {
+			sortF8(f, sv)
+		}
 	case sliceBias + reflect.Uint8: // [][]byte
 		b := *(*[][]byte)(unsafe.Pointer(&slc))
-		sortB(b)
+		if desc {
+			sortDescB(b, sv)
+		} else {
+			sortB(b, sv)
+		}
 	case reflect.String:
 		s := *(*[]string)(unsafe.Pointer(&slc))
-		sortS(s)
+		if desc {
+			sortDescS(s, sv)
+		} else {
+			sortS(s, sv)
+		}
 	default:
+		return false
+	}
+	return true
+}
+
+// IsSortedSlice returns 0 if ar is sorted in ascending order, otherwise
+// it returns i > 0 with ar[i] < ar[i-1]. ar's (underlying) type can be
+//
+//	[]int, []int32, []int64, []uint, []uint32, []uint64,
+//	[]uintptr, []float32, []float64, []string, [][]byte,
+//	[]unsafe.Pointer, []*T // for any type T
+//
+// otherwise it panics.
+//
+//go:nosplit
+func IsSortedSlice(ar any) int {
+	slc, kind := extractSK(ar)
+	if i := isSortedSK(slc, kind, false, NaNoption); i >= 0 {
+		return i
+	}
+	panic("sorty: IsSortedSlice: invalid input type")
+}
+
+// SortSlice concurrently sorts ar in ascending order. ar's (underlying) type can be
+//
+//	[]int, []int32, []int64, []uint, []uint32, []uint64,
+//	[]uintptr, []float32, []float64, []string, [][]byte,
+//	[]unsafe.Pointer, []*T // for any type T
+//
+// otherwise it panics.
+//
+//go:nosplit
+func SortSlice(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, false, std, nil) {
 		panic("sorty: SortSlice: invalid input type")
 	}
 }
+
+// SortSliceContext is like [SortSlice]() but can be canceled via ctx. Sorting goroutines
+// stop promptly when ctx is done, and it returns ctx.Err() after they all stop. A non-nil
+// result means ar may not be sorted, but it is always a permutation of its input.
+//
+//go:nosplit
+func SortSliceContext(ctx context.Context, ar any) error {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, false, std, ctx) {
+		panic("sorty: SortSliceContext: invalid input type")
+	}
+	return ctx.Err()
+}
+
+// IsSortedSliceDesc returns 0 if ar is sorted in descending order, otherwise it
+// returns i > 0 with ar[i] > ar[i-1]. ar's type can be as in [IsSortedSlice]().
+//
+//go:nosplit
+func IsSortedSliceDesc(ar any) int {
+	slc, kind := extractSK(ar)
+	if i := isSortedSK(slc, kind, true, NaNoption); i >= 0 {
+		return i
+	}
+	panic("sorty: IsSortedSliceDesc: invalid input type")
+}
+
+// SortSliceDesc concurrently sorts ar in descending order.
+// ar's type can be as in [SortSlice](), otherwise it panics.
+//
+//go:nosplit
+func SortSliceDesc(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, true, std, nil) {
+		panic("sorty: SortSliceDesc: invalid input type")
+	}
+}
+
+// IsSortedSliceOf is the type-checked version of [IsSortedSlice](). It returns 0
+// if ar is sorted in ascending order, otherwise it returns i > 0 with ar[i] < ar[i-1].
+//
+//go:nosplit
+func IsSortedSliceOf[T Native](ar []T) int {
+	slc, kind := sliceOf(ar)
+	return isSortedSK(slc, kind, false, NaNoption)
+}
+
+// SortSliceOf is the type-checked version of [SortSlice](). It concurrently
+// sorts ar in ascending order. Element type is resolved at compile time, so
+// unsupported types are rejected by the compiler instead of a runtime panic.
+//
+//go:nosplit
+func SortSliceOf[T Native](ar []T) {
+	slc, kind := sliceOf(ar)
+	sortSK(slc, kind, false, std, nil)
+}
+
+// IsSortedSliceDescOf is the type-checked version of [IsSortedSliceDesc](). It returns
+// 0 if ar is sorted in descending order, otherwise it returns i > 0 with ar[i] > ar[i-1].
+//
+//go:nosplit
+func IsSortedSliceDescOf[T Native](ar []T) int {
+	slc, kind := sliceOf(ar)
+	return isSortedSK(slc, kind, true, NaNoption)
+}
+
+// SortSliceDescOf is the type-checked version of [SortSliceDesc](). It
+// concurrently sorts ar in descending order.
+//
+//go:nosplit
+func SortSliceDescOf[T Native](ar []T) {
+	slc, kind := sliceOf(ar)
+	sortSK(slc, kind, true, std, nil)
+}
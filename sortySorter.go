@@ -0,0 +1,409 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+)
+
+// Sorter carries sorting parameters for its own Sort*() calls, so different users
+// of sorty in the same program do not need to share package-level [MaxGor],
+// [NaNoption] and [MaxLenIns] etc. A nil *Sorter uses the package-level values.
+// Use [NewSorter]() to start from package-level values:
+//
+//	srt := sorty.NewSorter()
+//	srt.MaxGor = 8
+//	srt.SortSlice(native_slice)
+type Sorter struct {
+	// MaxGor is the maximum number of goroutines (including caller) that can be
+	// concurrently used for sorting per Sort*() call. Like package-level [MaxGor],
+	// it can be changed live. MaxGor ≤ 1 yields single-goroutine sorting, [AutoGor]
+	// follows available CPUs.
+	MaxGor uint64
+
+	// Budget is an optional goroutine budget shared with other calls, see
+	// package-level [GorBudget]. It is nil (no budget) if nil.
+	Budget *Budget
+
+	// NaNoption determines how NaNs are handled, see package-level [NaNoption].
+	NaNoption FloatOption
+
+	// Max slice lengths for insertion sort & recursion, see package-level
+	// [MaxLenIns]. *FC versions are used when sorting strings or calling Sort().
+	MaxLenIns, MaxLenInsFC, MaxLenRec, MaxLenRecFC int
+
+	// Lens are optional max slice lengths for insertion sort & recursion per Kind
+	// of native slices, they override MaxLen* above if not zero.
+	Lens [NumKinds]Lengths
+
+	// Stats optionally collects statistics of calls, it is nil (disabled) if nil.
+	Stats *Stats
+
+	// Trace emits runtime/trace tasks & regions for partitioning and recursive
+	// sorting phases of calls, and sets pprof labels of ctx on helper goroutines
+	// of *Context(ctx) calls. Otherwise helpers inherit pprof labels of the calling
+	// goroutine, like labels set by pprof.Do(). If false, it costs a few nil checks.
+	Trace bool
+}
+
+// Kind identifies a native sorting kernel, for per-kind parameters in [Sorter].Lens.
+type Kind uint8
+
+// Kinds of native slices for [SortSlice](), [SortLen]() and related functions
+const (
+	KindI4   Kind = iota // []int32, []int on 32-bit platforms
+	KindI8               // []int64, []int on 64-bit platforms
+	KindU4               // []uint32, pointer slices on 32-bit platforms
+	KindU8               // []uint64, pointer slices on 64-bit platforms
+	KindF4               // []float32
+	KindF8               // []float64
+	KindS                // []string
+	KindB                // [][]byte
+	KindLenS             // []string by length
+	KindLenB             // [][]T by length
+	NumKinds             // number of kinds
+)
+
+var kindNames = [NumKinds]string{"I4", "I8", "U4", "U8", "F4", "F8", "S", "B", "LenS", "LenB"}
+
+func (k Kind) String() string {
+	if k < NumKinds {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Lengths are max slice lengths for insertion sort & recursion of a [Kind], like
+// [MaxLenIns] and [MaxLenRec]. Zero Lengths means not set.
+type Lengths struct {
+	Ins, Rec int
+}
+
+// valid returns true if l is not set or can be used for sorting
+func (l Lengths) valid() bool {
+	return l == Lengths{} || l.Rec > 2*l.Ins && l.Ins > 2*nsShort
+}
+
+// sliceKind returns Kind of slice kinds of extractSK() for sorting by value
+func sliceKind(kind reflect.Kind) Kind {
+	switch kind {
+	case reflect.Int32:
+		return KindI4
+	case reflect.Int64:
+		return KindI8
+	case reflect.Uint32:
+		return KindU4
+	case reflect.Uint64:
+		return KindU8
+	case reflect.Float32:
+		return KindF4
+	case reflect.Float64:
+		return KindF8
+	case sliceBias + reflect.Uint8:
+		return KindB
+	}
+	return KindS
+}
+
+// std is the nil Sorter, it uses package-level values
+var std *Sorter
+
+// NewSorter returns a Sorter initialized with package-level values.
+func NewSorter() *Sorter {
+	return &Sorter{MaxGor, GorBudget, NaNoption, MaxLenIns, MaxLenInsFC, MaxLenRec,
+		MaxLenRecFC, [NumKinds]Lengths{}, nil, false}
+}
+
+// newVar returns per-call variables for arithmetic & by-length (fc=false) or
+// string & lesswap (fc=true) sorting. It panics for invalid Sorter values.
+func (s *Sorter) newVar(fc bool) *syncVar {
+	sv := &syncVar{nGor: 1} // number of goroutines including this
+	if s == nil {
+		sv.maxGor, sv.budget, sv.nan = &MaxGor, GorBudget, NaNoption
+		if fc {
+			sv.ins, sv.rec = MaxLenInsFC, MaxLenRecFC
+		} else {
+			sv.ins, sv.rec = MaxLenIns, MaxLenRec
+		}
+		return sv
+	}
+
+	sv.maxGor, sv.budget, sv.nan = &s.MaxGor, s.Budget, s.NaNoption
+	if fc {
+		sv.ins, sv.rec = s.MaxLenInsFC, s.MaxLenRecFC
+	} else {
+		sv.ins, sv.rec = s.MaxLenIns, s.MaxLenRec
+	}
+	if !((4097 > s.MaxGor || s.MaxGor == AutoGor) && sv.rec > 2*sv.ins &&
+		sv.ins > 2*nsShort) {
+		panic("sorty: check your Sorter values")
+	}
+	if s.Stats != nil {
+		sv.st = newStats(s.Stats)
+	}
+	if s.Trace {
+		sv.tc = context.Background()
+	}
+	return sv
+}
+
+// kindVar returns per-call variables for sorting native slices of kind k, with
+// per-kind lengths if set. It panics for invalid Sorter values.
+func (s *Sorter) kindVar(k Kind) *syncVar {
+	sv := s.newVar(k == KindS || k == KindB)
+	if s == nil {
+		return sv
+	}
+	l := s.Lens[k]
+	if !l.valid() {
+		panic("sorty: check your Sorter values")
+	}
+	if l != (Lengths{}) {
+		sv.ins, sv.rec = l.Ins, l.Rec
+	}
+	return sv
+}
+
+// nanOpt returns NaN handling option of s
+func (s *Sorter) nanOpt() FloatOption {
+	if s == nil {
+		return NaNoption
+	}
+	return s.NaNoption
+}
+
+// IsSortedSlice is like package-level [IsSortedSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) IsSortedSlice(ar any) int {
+	slc, kind := extractSK(ar)
+	if i := isSortedSK(slc, kind, false, s.nanOpt()); i >= 0 {
+		return i
+	}
+	panic("sorty: IsSortedSlice: invalid input type")
+}
+
+// SortSlice is like package-level [SortSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortSlice(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, false, s, nil) {
+		panic("sorty: SortSlice: invalid input type")
+	}
+}
+
+// SortSliceContext is like package-level [SortSliceContext]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortSliceContext(ctx context.Context, ar any) error {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, false, s, ctx) {
+		panic("sorty: SortSliceContext: invalid input type")
+	}
+	return ctx.Err()
+}
+
+// IsSortedSliceDesc is like package-level [IsSortedSliceDesc]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) IsSortedSliceDesc(ar any) int {
+	slc, kind := extractSK(ar)
+	if i := isSortedSK(slc, kind, true, s.nanOpt()); i >= 0 {
+		return i
+	}
+	panic("sorty: IsSortedSliceDesc: invalid input type")
+}
+
+// SortSliceDesc is like package-level [SortSliceDesc]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortSliceDesc(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortSK(slc, kind, true, s, nil) {
+		panic("sorty: SortSliceDesc: invalid input type")
+	}
+}
+
+// SortLen is like package-level [SortLen]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortLen(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortLenSK(slc, kind, false, s, nil) {
+		panic("sorty: SortLen: invalid input type")
+	}
+}
+
+// SortLenContext is like package-level [SortLenContext]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortLenContext(ctx context.Context, ar any) error {
+	slc, kind := extractSK(ar)
+	if !sortLenSK(slc, kind, false, s, ctx) {
+		panic("sorty: SortLenContext: invalid input type")
+	}
+	return ctx.Err()
+}
+
+// SortLenDesc is like package-level [SortLenDesc]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortLenDesc(ar any) {
+	slc, kind := extractSK(ar)
+	if !sortLenSK(slc, kind, true, s, nil) {
+		panic("sorty: SortLenDesc: invalid input type")
+	}
+}
+
+// Sort is like package-level [Sort]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) Sort(n int, lsw Lesswap) {
+	sv := s.newVar(true)
+	sortLw(n, sv.count(lsw), sv)
+}
+
+// SortContext is like package-level [SortContext]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortContext(ctx context.Context, n int, lsw Lesswap) error {
+	sv := s.newVar(true)
+	sv.setCtx(ctx)
+	sortLw(n, sv.count(lsw), sv)
+	return ctx.Err()
+}
+
+// SortStable is like package-level [SortStable]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortStable(n int, lsw Lesswap) {
+	sortStable(n, lsw, s.newVar(true))
+}
+
+// SortSliceRadix is like package-level [SortSliceRadix]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortSliceRadix(ar any) {
+	slc, kind := extractSK(ar)
+	if isPtrSlice(ar) || !radixSK(slc, kind, s) {
+		panic("sorty: SortSliceRadix: invalid input type")
+	}
+}
+
+// PartialSortSlice is like package-level [PartialSortSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) PartialSortSlice(ar any, k int) {
+	slc, kind := extractSK(ar)
+	if !partialSK(slc, kind, k, s) {
+		panic("sorty: PartialSortSlice: invalid input type")
+	}
+}
+
+// PartialSort is like package-level [PartialSort]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) PartialSort(n, k int, lsw Lesswap) {
+	partial(n, k, lsw, s.newVar(true))
+}
+
+// NthElementSlice is like package-level [NthElementSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) NthElementSlice(ar any, k int) {
+	slc, kind := extractSK(ar)
+	if !selectSK(slc, kind, []int{k}, s) {
+		panic("sorty: NthElementSlice: invalid input type")
+	}
+}
+
+// NthElement is like package-level [NthElement]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) NthElement(n, k int, lsw Lesswap) {
+	selectLw(n, lsw, []int{k}, s)
+}
+
+// SelectSlice is like package-level [SelectSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SelectSlice(ar any, ranks ...int) {
+	slc, kind := extractSK(ar)
+	if !selectSK(slc, kind, ranks, s) {
+		panic("sorty: SelectSlice: invalid input type")
+	}
+}
+
+// Select is like package-level [Select]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) Select(n int, lsw Lesswap, ranks ...int) {
+	selectLw(n, lsw, ranks, s)
+}
+
+// ArgSortSlice is like package-level [ArgSortSlice]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) ArgSortSlice(ar any) []int {
+	slc, kind := extractSK(ar)
+	if p := argSK(slc, kind, s); p != nil {
+		return p
+	}
+	panic("sorty: ArgSortSlice: invalid input type")
+}
+
+// ArgSort is like package-level [ArgSort]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) ArgSort(n int, less func(i, k int) bool) []int {
+	return argLess(n, less, false, s.newVar(true))
+}
+
+// ArgSortStable is like package-level [ArgSortStable]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) ArgSortStable(n int, less func(i, k int) bool) []int {
+	return argLess(n, less, true, s.newVar(true))
+}
+
+// SortPairs is like package-level [SortPairs]() with s's parameters.
+//
+//go:nosplit
+func (s *Sorter) SortPairs(keys any, payloads ...any) {
+	if !pairSK(keys, payloads, s) {
+		panic("sorty: SortPairs: invalid input type")
+	}
+}
+
+// SortByKeyWith is like package-level [SortByKey]() with s's parameters. Methods
+// cannot have type parameters, hence the function.
+func SortByKeyWith[T any, K Ordered](s *Sorter, ar []T, key func(T) K) {
+	sortByKey(ar, key, s)
+}
+
+// ColumnPerm is like package-level [ColumnPerm]() with s's parameters.
+func (s *Sorter) ColumnPerm(cols ...Column) []int {
+	if p := columnPerm(cols, s); p != nil {
+		return p
+	}
+	panic("sorty: ColumnPerm: invalid input")
+}
+
+// SortColumns is like package-level [SortColumns]() with s's parameters.
+func (s *Sorter) SortColumns(cols []Column, others ...any) {
+	if !sortColumns(cols, others, s) {
+		panic("sorty: SortColumns: invalid input")
+	}
+}
+
+// CheckedSort is like package-level [CheckedSort]() with s's parameters.
+func (s *Sorter) CheckedSort(n int, lsw Lesswap) error {
+	return checkedSort(n, lsw, s.newVar(true))
+}
@@ -0,0 +1,194 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+// Lesswap can only swap when its comparison is true. Stable sorting below only
+// swaps elements a > b where a is before b, so equal elements never swap.
+
+// rotate swaps blocks [a,m) and [m,b), assumes each member of [a,m) is larger
+// than each member of [m,b). Block swaps are always between the two blocks.
+//
+//go:nosplit
+func rotate(lsw Lesswap, a, m, b int) {
+	for i, j := m-a, b-m; i > 0 && j > 0; {
+		if i >= j {
+			// swap last j of [a,m) with [m,b), which is then in place
+			for p := m - j; p < m; p++ {
+				lsw(p+j, p, p, p+j)
+			}
+			b = m
+			m -= j
+			i -= j
+		} else {
+			// swap [a,m) with first i of [m,b), which is then in place
+			for p := a; p < m; p++ {
+				lsw(p+i, p, p, p+i)
+			}
+			a = m
+			m += i
+			j -= i
+		}
+	}
+}
+
+// symMerge stably merges sorted [a,m) and [m,b) in-place via [SymMerge]
+// algorithm of Pok-Son Kim and Arne Kutzner, recursive
+//
+// [SymMerge]: https://doi.org/10.1007/978-3-540-30140-0_63
+func symMerge(lsw Lesswap, a, m, b int, sv *syncVar) {
+	if m-a == 1 {
+		// find lowest i in [m,b) with slc[a] ≤ slc[i], or b
+		i, j := m, b
+		for i < j {
+			h := int(uint(i+j) >> 1)
+			if lsw(h, a, h, h) { // 3rd=4th disables swap
+				i = h + 1
+			} else {
+				j = h
+			}
+		}
+		for k := a + 1; k < i; k++ { // move slc[a] to i-1
+			lsw(k, k-1, k-1, k)
+		}
+		return
+	}
+	if b-m == 1 {
+		// find lowest i in [a,m) with slc[m] < slc[i], or m
+		i, j := a, m
+		for i < j {
+			h := int(uint(i+j) >> 1)
+			if lsw(m, h, m, m) { // 3rd=4th disables swap
+				j = h
+			} else {
+				i = h + 1
+			}
+		}
+		for k := m; k > i; k-- { // move slc[m] to i
+			lsw(k, k-1, k-1, k)
+		}
+		return
+	}
+
+	mid := int(uint(a+b) >> 1)
+	n := mid + m
+	var start, r int
+	if m > mid {
+		start = n - b
+		r = mid
+	} else {
+		start = a
+		r = m
+	}
+	p := n - 1
+
+	for start < r {
+		c := int(uint(start+r) >> 1)
+		if lsw(p-c, c, c, c) { // 3rd=4th disables swap
+			r = c
+		} else {
+			start = c + 1
+		}
+	}
+
+	end := n - start
+	if start < m && m < end {
+		// slc[end-1] < slc[start], so [start,m) > [m,end)
+		rotate(lsw, start, m, end)
+	}
+
+	lo := a < start && start < mid
+	hi := mid < end && end < b
+
+	// both merges big enough? max goroutines?
+	if lo && hi && b-a > sv.rec && !gorFull(sv) && addGor(sv, 1) { // increase goroutine counters
+		ch := make(chan int, 1) // helper never blocks if we panic
+		go gSymMerge(lsw, mid, end, b, sv, ch)
+
+		symMerge(lsw, a, start, mid, sv)
+		<-ch
+		return
+	}
+	if lo {
+		symMerge(lsw, a, start, mid, sv)
+	}
+	if hi {
+		symMerge(lsw, mid, end, b, sv)
+	}
+}
+
+// new-goroutine merge function
+//
+//go:nosplit
+func gSymMerge(lsw Lesswap, a, m, b int, sv *syncVar, ch chan int) {
+	defer gEnd(sv, ch)
+	defer endRegion(gStart(sv, regionSort))
+	symMerge(lsw, a, m, b, sv)
+}
+
+// stable sorts [lo,hi), recursive
+func stable(lsw Lesswap, lo, hi int, sv *syncVar) {
+	if canceled(sv) {
+		return
+	}
+	if hi-lo <= sv.ins {
+		insertion(lsw, lo, hi-1) // stable, swaps only if slc[l] < slc[l-1]
+		return
+	}
+	mid := int(uint(lo+hi) >> 1)
+
+	// both halves big enough? max goroutines?
+	if hi-mid > sv.rec && !gorFull(sv) && addGor(sv, 1) { // increase goroutine counters
+		ch := make(chan int, 1) // helper never blocks if we panic
+		go gStable(lsw, mid, hi, sv, ch)
+
+		stable(lsw, lo, mid, sv)
+		<-ch
+	} else {
+		stable(lsw, lo, mid, sv)
+		stable(lsw, mid, hi, sv)
+	}
+
+	if lsw(mid, mid-1, mid, mid) { // 3rd=4th disables swap
+		symMerge(lsw, lo, mid, hi, sv) // not already in order
+	}
+}
+
+// new-goroutine stable sort function
+//
+//go:nosplit
+func gStable(lsw Lesswap, lo, hi int, sv *syncVar, ch chan int) {
+	defer gEnd(sv, ch)
+	defer endRegion(gStart(sv, regionSort))
+	stable(lsw, lo, hi, sv)
+}
+
+// sortStable concurrently and stably sorts underlying collection of length n
+//
+//go:nosplit
+func sortStable(n int, lsw Lesswap, sv *syncVar) {
+	if n > sv.rec { // may be concurrent
+		sv.done = make(chan int) // end signal
+		defer sv.quit()          // wait for goroutines, propagate panics
+		sv.newTask()             // trace concurrent sorting, if enabled
+	}
+	if n > 1 {
+		sv.enter(regionSort)
+		stable(sv.count(lsw), 0, n, sv)
+		sv.leave()
+	}
+	sv.phase(sortPhase)
+}
+
+// SortStable concurrently sorts underlying collection of length n via lsw(),
+// keeping the original order of equal elements. It is an in-place merge sort
+// that only needs the [Lesswap] contract, no extra buffer. It does
+// O(n·log²n) comparisons & swaps, so it is slower than [Sort]().
+//
+//go:nosplit
+func SortStable(n int, lsw Lesswap) {
+	sortStable(n, lsw, std.newVar(true))
+}
@@ -0,0 +1,156 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats collects statistics of Sort*() calls of a [Sorter] to find out why sorting
+// takes long. Set [Sorter].Stats to enable collection, it is nil (disabled) by
+// default. Statistics of calls sharing a Stats accumulate. They are updated
+// atomically during calls, so read them after calls return. Collection slows down
+// sorting a bit, and [Lesswap] based sorting considerably. For example:
+//
+//	var st sorty.Stats
+//	srt := sorty.NewSorter()
+//	srt.Stats = &st
+//	srt.SortSlice(native_slice)
+//	fmt.Printf("%+v\n", st)
+type Stats struct {
+	// Comparisons and Swaps count lesswap() calls & swaps of Lesswap based sorting
+	// like Sort(), SortStable(), Select() and ArgSort(). Native
+	// slices are compared inline and their comparisons are not counted.
+	Comparisons, Swaps uint64
+
+	// Partitions is the number of partitioning steps. MaxDepth is the max number
+	// of nested partitioning steps in a call.
+	Partitions, MaxDepth uint64
+
+	// Imbalance is the histogram of partitioning steps by the shorter range's share
+	// of partitioned members: Imbalance[i] counts steps with share in [5i%,5i+5%),
+	// and the last bucket includes 50%. Low buckets suggest poor pivots.
+	Imbalance [10]uint64
+
+	// Goroutines is the number of helper goroutines created. MaxGoroutines is the
+	// max number of goroutines (including caller) concurrently used by a call.
+	Goroutines, MaxGoroutines uint64
+
+	// Time spent by calling goroutines in phases: concurrent partitioning (Part),
+	// sorting their own ranges & preparations like NaN handling (Sort), and waiting
+	// for helper goroutines to finish (Wait).
+	Part, Sort, Wait time.Duration
+}
+
+// phases of a call
+const (
+	partPhase = iota
+	sortPhase
+	waitPhase
+)
+
+// per-call statistics
+type callStats struct {
+	*Stats
+	mark time.Time // end of last phase, updated by calling goroutine
+	top  int64     // partitioning budget of the call + 1
+}
+
+// newStats returns per-call statistics that are collected into st
+func newStats(st *Stats) *callStats {
+	atomicMax(&st.MaxGoroutines, 1)
+	return &callStats{Stats: st, mark: time.Now()}
+}
+
+// atomicMax sets *p to max(*p, v)
+func atomicMax(p *uint64, v uint64) {
+	for {
+		o := atomic.LoadUint64(p)
+		if v <= o || atomic.CompareAndSwapUint64(p, o, v) {
+			return
+		}
+	}
+}
+
+// partStat records a partitioning step into ranges of lengths a & b with remaining
+// partitioning budget depth, inlined
+func (sv *syncVar) partStat(a, b, depth int) {
+	if sv.st != nil {
+		sv.st.part(a, b, depth)
+	}
+}
+
+func (c *callStats) part(a, b, depth int) {
+	atomic.AddUint64(&c.Partitions, 1)
+
+	if n := a + b; n > 0 {
+		if a > b {
+			a = b // shorter range
+		}
+		i := 20 * uint64(a) / uint64(n)
+		if i >= uint64(len(c.Imbalance)) {
+			i = uint64(len(c.Imbalance)) - 1
+		}
+		atomic.AddUint64(&c.Imbalance[i], 1)
+	}
+
+	// first partitioning step of a call is at the top level
+	atomic.CompareAndSwapInt64(&c.top, 0, int64(depth)+1)
+	atomicMax(&c.MaxDepth, uint64(atomic.LoadInt64(&c.top)-int64(depth)))
+}
+
+// gorStat records d new helper goroutines, n is the new number of goroutines, inlined
+func (sv *syncVar) gorStat(d, n uint64) {
+	if sv.st != nil {
+		atomic.AddUint64(&sv.st.Goroutines, d)
+		atomicMax(&sv.st.MaxGoroutines, n)
+	}
+}
+
+// phase adds the time since the end of last phase to phase p, called only by
+// calling goroutine, inlined
+func (sv *syncVar) phase(p int) {
+	if sv.st != nil {
+		sv.st.phase(p)
+	}
+}
+
+func (c *callStats) phase(p int) {
+	d := &c.Sort
+	switch p {
+	case partPhase:
+		d = &c.Part
+	case waitPhase:
+		d = &c.Wait
+	}
+	now := time.Now()
+	atomic.AddInt64((*int64)(d), int64(now.Sub(c.mark)))
+	c.mark = now
+}
+
+// count returns lsw as is, or a wrapper that counts its calls & swaps if sv
+// collects statistics, inlined
+func (sv *syncVar) count(lsw Lesswap) Lesswap {
+	if sv.st != nil {
+		return sv.st.count(lsw)
+	}
+	return lsw
+}
+
+func (c *callStats) count(lsw Lesswap) Lesswap {
+	return func(i, k, r, s int) bool {
+		atomic.AddUint64(&c.Comparisons, 1)
+		if lsw(i, k, r, s) {
+			if r != s {
+				atomic.AddUint64(&c.Swaps, 1)
+			}
+			return true
+		}
+		return false
+	}
+}
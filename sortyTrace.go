@@ -0,0 +1,88 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// runtime/trace task & region names
+const (
+	traceTask  = "sorty"
+	regionPart = "sorty.partition" // concurrent partitioning
+	regionSort = "sorty.sort"      // recursive sorting
+	regionWait = "sorty.wait"      // waiting for helper goroutines
+)
+
+// setCtx sets cancellation signal and, if tracing, context of sv from ctx of a
+// *Context() call. Helper goroutines of sv will have pprof labels of ctx.
+func (sv *syncVar) setCtx(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	sv.stop = ctx.Done()
+	if sv.tc != nil {
+		sv.tc, sv.lbl = ctx, true
+	}
+}
+
+// newTask starts a runtime/trace task for concurrent sorting if tracing, so that
+// regions of helper goroutines belong to it. It is ended by quit().
+func (sv *syncVar) newTask() {
+	if sv.tc != nil {
+		sv.tc, sv.task = trace.NewTask(sv.tc, traceTask)
+	}
+}
+
+// endTask ends task of sv if any
+func (sv *syncVar) endTask() {
+	if sv.task != nil {
+		sv.task.End()
+	}
+}
+
+// enter starts a runtime/trace region of the calling goroutine if tracing, inlined
+func (sv *syncVar) enter(name string) {
+	if sv.tc != nil {
+		sv.reg = trace.StartRegion(sv.tc, name)
+	}
+}
+
+// leave ends the region of the calling goroutine if any, inlined
+func (sv *syncVar) leave() {
+	if sv.reg != nil {
+		sv.reg.End()
+		sv.reg = nil
+	}
+}
+
+// endRegion ends region r if not nil, inlined
+func endRegion(r *trace.Region) {
+	if r != nil {
+		r.End()
+	}
+}
+
+// gStart is called by helper goroutines when they start. If tracing, it sets pprof
+// labels of the call's context, if any, and starts a region. Otherwise helpers keep
+// pprof labels inherited from the goroutine that created them, inlined
+func gStart(sv *syncVar, name string) *trace.Region {
+	if sv.tc == nil {
+		return nil
+	}
+	return sv.gTrace(name)
+}
+
+// gTrace sets pprof labels of the call's context if any and starts region name
+func (sv *syncVar) gTrace(name string) *trace.Region {
+	if sv.lbl {
+		pprof.SetGoroutineLabels(sv.tc)
+	}
+	return trace.StartRegion(sv.tc, name)
+}
@@ -0,0 +1,204 @@
+/*	Copyright (c) 2026, Serhat Şevki Dinçer.
+	This Source Code Form is subject to the terms of the Mozilla Public
+	License, v. 2.0. If a copy of the MPL was not distributed with this
+	file, You can obtain one at http://mozilla.org/MPL/2.0/.
+*/
+
+package sorty
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"strconv"
+	"time"
+	"unsafe"
+
+	"github.com/jfcg/opt"
+)
+
+// calibration sample length & repetitions per measurement
+const calLen, calRep = 1 << 15, 3
+
+// calibrate minimizes cost(ins,rec) over feasible thresholds starting at (ins,rec),
+// it stops measuring at deadline and returns the best point found
+func calibrate(ins, rec int, deadline time.Time, cost func(ins, rec int) time.Duration) (int, int) {
+	x, y, _, _ := opt.FindMinTri(2, ins, rec, ins/4, rec/4, func(x, y int) float64 {
+		if x <= 2*nsShort || y <= 2*x || time.Now().After(deadline) {
+			return 9e9 // keep parameters feasible, or out of time
+		}
+		best := cost(x, y)
+		for r := 1; r < calRep; r++ { // least noisy of calRep runs
+			if d := cost(x, y); d < best {
+				best = d
+			}
+		}
+		return best.Seconds() + 1e-9 // positive
+	}, nil)
+	return x, y
+}
+
+// trial returns a function that measures sorting a copy of src via sort()
+func trial[T any](src []T, sort func([]T)) func() time.Duration {
+	buf := make([]T, len(src))
+	return func() time.Duration {
+		copy(buf, src)
+		now := time.Now()
+		sort(buf)
+		return time.Since(now)
+	}
+}
+
+// Calibrate tunes insertion sort & recursion thresholds of s on the running machine
+// with a short search per [Kind] that takes about budget in total. It sets s.Lens
+// for each Kind by sorting random native slices, and MaxLenInsFC & MaxLenRecFC by
+// sorting via [Sort](), with the MaxGor of s, starting from current values of s.
+// Package-level MaxLen* are constants, so results are only used by calls of s.
+func (s *Sorter) Calibrate(budget time.Duration) {
+	rnd := rand.New(rand.NewSource(1))
+	u4, u8 := make([]uint32, calLen), make([]uint64, calLen)
+	f4, f8 := make([]float32, calLen), make([]float64, calLen)
+	ss, bs := make([]string, calLen), make([][]byte, calLen)
+	ls, lb := make([]string, calLen), make([][]byte, calLen)
+	long := strconv.FormatUint(rnd.Uint64(), 2) // 64 bytes or less
+	for i := range u4 {
+		u4[i], u8[i] = rnd.Uint32(), rnd.Uint64()
+		f8[i] = rnd.NormFloat64()
+		f4[i] = float32(f8[i])
+		ss[i] = strconv.FormatUint(u8[i], 36)
+		bs[i] = []byte(ss[i])
+		ls[i] = long[:rnd.Intn(len(long)+1)]
+		lb[i] = []byte(long[:rnd.Intn(len(long)+1)])
+	}
+	i4 := *(*[]int32)(unsafe.Pointer(&u4))
+	i8 := *(*[]int64)(unsafe.Pointer(&u8))
+
+	c := *s // trial values, not collected or traced
+	c.Stats, c.Trace = nil, false
+	cost := [NumKinds]func() time.Duration{
+		trial(i4, func(a []int32) { c.SortSlice(a) }),
+		trial(i8, func(a []int64) { c.SortSlice(a) }),
+		trial(u4, func(a []uint32) { c.SortSlice(a) }),
+		trial(u8, func(a []uint64) { c.SortSlice(a) }),
+		trial(f4, func(a []float32) { c.SortSlice(a) }),
+		trial(f8, func(a []float64) { c.SortSlice(a) }),
+		trial(ss, func(a []string) { c.SortSlice(a) }),
+		trial(bs, func(a [][]byte) { c.SortSlice(a) }),
+		trial(ls, func(a []string) { c.SortLen(a) }),
+		trial(lb, func(a [][]byte) { c.SortLen(a) }),
+	}
+	start, part := time.Now(), budget/time.Duration(NumKinds+1)
+
+	for k := range cost {
+		l := s.Lens[k]
+		if l == (Lengths{}) {
+			l = Lengths{s.MaxLenIns, s.MaxLenRec}
+			if Kind(k) == KindS || Kind(k) == KindB {
+				l = Lengths{s.MaxLenInsFC, s.MaxLenRecFC}
+			}
+		}
+		end := start.Add(part * time.Duration(k+1))
+		s.Lens[k].Ins, s.Lens[k].Rec = calibrate(l.Ins, l.Rec, end,
+			func(ins, rec int) time.Duration {
+				c.Lens[k] = Lengths{ins, rec}
+				return cost[k]()
+			})
+		c.Lens[k] = s.Lens[k]
+	}
+
+	lsw := trial(u4, func(a []uint32) {
+		c.Sort(len(a), func(i, k, r, t int) bool {
+			if a[i] < a[k] {
+				if r != t {
+					a[r], a[t] = a[t], a[r]
+				}
+				return true
+			}
+			return false
+		})
+	})
+	s.MaxLenInsFC, s.MaxLenRecFC = calibrate(s.MaxLenInsFC, s.MaxLenRecFC, start.Add(budget),
+		func(ins, rec int) time.Duration {
+			c.MaxLenInsFC, c.MaxLenRecFC = ins, rec
+			return lsw()
+		})
+}
+
+// Calibrate returns a [NewSorter]() tuned with [Sorter.Calibrate](budget).
+func Calibrate(budget time.Duration) *Sorter {
+	s := NewSorter()
+	s.Calibrate(budget)
+	return s
+}
+
+// profile is the saved tuning parameters of a Sorter
+type profile struct {
+	MaxLenIns, MaxLenInsFC, MaxLenRec, MaxLenRecFC int
+
+	Lens map[string]Lengths `json:",omitempty"` // set per-kind lengths by Kind name
+}
+
+// profileOf returns tuning parameters of s
+func profileOf(s *Sorter) profile {
+	p := profile{s.MaxLenIns, s.MaxLenInsFC, s.MaxLenRec, s.MaxLenRecFC, nil}
+	for k, l := range s.Lens {
+		if l != (Lengths{}) {
+			if p.Lens == nil {
+				p.Lens = make(map[string]Lengths)
+			}
+			p.Lens[kindNames[k]] = l
+		}
+	}
+	return p
+}
+
+// lens returns per-kind lengths of p, false if p has invalid values or Kind names
+func (p *profile) lens() (lens [NumKinds]Lengths, ok bool) {
+	if !(p.MaxLenRec > 2*p.MaxLenIns && p.MaxLenIns > 2*nsShort &&
+		p.MaxLenRecFC > 2*p.MaxLenInsFC && p.MaxLenInsFC > 2*nsShort) {
+		return
+	}
+next:
+	for name, l := range p.Lens {
+		for k := range kindNames {
+			if kindNames[k] == name && l.valid() {
+				lens[k] = l
+				continue next
+			}
+		}
+		return
+	}
+	return lens, true
+}
+
+// SaveProfile writes tuning parameters (MaxLenIns etc.) of s to file as JSON, for
+// example after [Sorter.Calibrate]().
+func (s *Sorter) SaveProfile(file string) error {
+	b, err := json.MarshalIndent(profileOf(s), "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(b, '\n'), 0o644)
+}
+
+// LoadProfile sets tuning parameters of s from file written by [Sorter.SaveProfile]().
+// Missing MaxLen* keep their values, per-kind lengths missing in file are unset.
+// s is not modified if file cannot be read or has invalid values.
+func (s *Sorter) LoadProfile(file string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	p := profile{s.MaxLenIns, s.MaxLenInsFC, s.MaxLenRec, s.MaxLenRecFC, nil}
+	if err = json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	lens, ok := p.lens()
+	if !ok {
+		return errors.New("sorty: invalid tuning profile " + file)
+	}
+	s.MaxLenIns, s.MaxLenInsFC, s.MaxLenRec, s.MaxLenRecFC, s.Lens =
+		p.MaxLenIns, p.MaxLenInsFC, p.MaxLenRec, p.MaxLenRecFC, lens
+	return nil
+}
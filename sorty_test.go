@@ -78,13 +78,15 @@ func copyPrepSortTest(buf []uint32, prepare func([]uint32) any,
 
 func isValueSort(srf func(any)) bool {
 	sPtr := reflect.ValueOf(srf).Pointer()
-	return sPtr == stdSortPtr || sPtr == sortSlcPtr || sPtr == sortLswPtr
+	return sPtr == stdSortPtr || sPtr == sortSlcPtr || sPtr == sortLswPtr ||
+		sPtr == srtSlcPtr
 }
 
 var (
-	stdSortPtr = reflect.ValueOf(stdSort).Pointer()   // standard sort.Slice
-	sortSlcPtr = reflect.ValueOf(SortSlice).Pointer() // sorty
-	sortLswPtr = reflect.ValueOf(sortLsw).Pointer()   // sorty
+	stdSortPtr = reflect.ValueOf(stdSort).Pointer()       // standard sort.Slice
+	sortSlcPtr = reflect.ValueOf(SortSlice).Pointer()     // sorty
+	sortLswPtr = reflect.ValueOf(sortLsw).Pointer()       // sorty
+	srtSlcPtr  = reflect.ValueOf(std.SortSlice).Pointer() // sorty, any Sorter
 )
 
 func stdSort(ar any) {
@@ -324,6 +326,24 @@ func U4toF4(buf []uint32) any {
 	return *(*[]float32)(unsafe.Pointer(&buf))
 }
 
+func U4toU8(buf []uint32) any {
+	return sixb.U4toU8(buf)
+}
+
+func U4toI4(buf []uint32) any {
+	return *(*[]int32)(unsafe.Pointer(&buf))
+}
+
+func U4toI8(buf []uint32) any {
+	slc := sixb.U4toU8(buf)
+	return *(*[]int64)(unsafe.Pointer(&slc))
+}
+
+func U4toF8(buf []uint32) any {
+	slc := sixb.U4toU8(buf)
+	return *(*[]float64)(unsafe.Pointer(&slc))
+}
+
 // return sum of sortF4() durations for 1..maxMaxGor goroutines
 // optionally compare with standard sort.Slice
 func sumDurF4(compStd bool) (sum float64) {
@@ -550,3 +570,67 @@ func sumDurLswB(compStd bool) (sum float64) {
 	}
 	return
 }
+
+// presorted input patterns, fill buf from srcBuf
+var presorted = [...]struct {
+	name string
+	fill func(buf []uint32)
+}{
+	{"Sorted", func(buf []uint32) {
+		for i := range buf {
+			buf[i] = uint32(i)
+		}
+	}},
+	{"Reversed", func(buf []uint32) {
+		for i := range buf {
+			buf[i] = uint32(len(buf) - i)
+		}
+	}},
+	{"SortedTail", func(buf []uint32) { // random tail of length n/16
+		k := len(buf) - len(buf)>>4
+		for i := 0; i < k; i++ {
+			buf[i] = uint32(i)
+		}
+		copy(buf[k:], srcBuf)
+	}},
+	{"FewSwaps", func(buf []uint32) { // 4 random swaps
+		for i := range buf {
+			buf[i] = uint32(i)
+		}
+		for i := 0; i < 8; i += 2 {
+			k, l := srcBuf[i]%uint32(len(buf)), srcBuf[i+1]%uint32(len(buf))
+			buf[k], buf[l] = buf[l], buf[k]
+		}
+	}},
+	{"Random", func(buf []uint32) {
+		copy(buf, srcBuf)
+	}},
+}
+
+func benchPresorted(b *testing.B, srf func([]uint32)) {
+	fillSrc()
+	buf := aaBuf[:1<<20]
+
+	for _, p := range presorted {
+		b.Run(p.name, func(b *testing.B) {
+			for q := 0; q < b.N; q++ {
+				b.StopTimer()
+				p.fill(buf)
+				b.StartTimer()
+				srf(buf)
+			}
+			b.StopTimer()
+			if isSortedU4(buf) != 0 {
+				b.Fatal("not sorted")
+			}
+		})
+	}
+}
+
+func BenchmarkPresortedSlice(b *testing.B) {
+	benchPresorted(b, func(buf []uint32) { SortSlice(buf) })
+}
+
+func BenchmarkPresortedLsw(b *testing.B) {
+	benchPresorted(b, func(buf []uint32) { sortLsw(buf) })
+}
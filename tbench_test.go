@@ -25,7 +25,7 @@ func BenchmarkSortB(b *testing.B) {
 			}
 		}
 		b.StartTimer()
-		sortB(slc)
+		sortB(slc, std.newVar(true))
 		b.StopTimer()
 	}
 	if isSortedB(slc) != 0 {
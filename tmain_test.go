@@ -10,12 +10,21 @@
 package sorty
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 	"unsafe"
-
-	"github.com/jfcg/sixb"
 )
 
 func printSec(testName string, d time.Duration) float64 {
@@ -136,24 +145,6 @@ func TestByteSliceByLen(t *testing.T) {
 	sumDurLenB(true) // sorty
 }
 
-func U4toU8(buf []uint32) any {
-	return sixb.U4toU8(buf)
-}
-
-func U4toI4(buf []uint32) any {
-	return *(*[]int32)(unsafe.Pointer(&buf))
-}
-
-func U4toI8(buf []uint32) any {
-	slc := sixb.U4toU8(buf)
-	return *(*[]int64)(unsafe.Pointer(&slc))
-}
-
-func U4toF8(buf []uint32) any {
-	slc := sixb.U4toU8(buf)
-	return *(*[]float64)(unsafe.Pointer(&slc))
-}
-
 func sortSignal(buf []uint32, prepare func([]uint32) any, ch chan struct{}) {
 	copyPrepSortTest(buf, prepare, SortSlice)
 	if ch != nil {
@@ -247,3 +238,1639 @@ func iarlsw(i, k, r, s int) bool {
 	}
 	return false
 }
+
+type namedU4 uint32
+
+// sort a with SortSliceOf() & b with SortSlice(), compare results
+func sortCompareOf[T Native](a, b []T) {
+	SortSliceOf(a)
+	SortSlice(b)
+
+	if IsSortedSliceOf(a) != 0 {
+		tsPtr.Fatal("SortSliceOf/IsSortedSliceOf does not work")
+	}
+	compare(a, b)
+}
+
+// SortSliceOf() must agree with SortSlice()
+func TestSliceOf(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+
+	for _, L := range [...]int{1, 1 << 10, 1 << 20} {
+		buf1, buf2 := aaBuf[:L], bbBuf[:L]
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		sortCompareOf(buf1, buf2)
+
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		n1 := *(*[]namedU4)(unsafe.Pointer(&buf1))
+		n2 := *(*[]namedU4)(unsafe.Pointer(&buf2))
+		sortCompareOf(n1, n2) // named element type
+
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		sortCompareOf(U4toF8(buf1).([]float64), U4toF8(buf2).([]float64))
+
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		sortCompareOf(implantS(buf1).([]string), implantS(buf2).([]string))
+	}
+
+	SortSliceOf(iArr)
+	if IsSortedSlice(iArr) != 0 {
+		t.Fatal("SortSliceOf() does not work")
+	}
+}
+
+// reverse ar in place
+func reverse(ar any) {
+	swap := reflect.Swapper(ar)
+	for l, h := 0, reflect.ValueOf(ar).Len()-1; l < h; l, h = l+1, h-1 {
+		swap(l, h)
+	}
+}
+
+// descending sort must be the reverse of ascending sort
+func TestDesc(t *testing.T) {
+	tsPtr = t
+	lsPrep := [...]func([]uint32) any{
+		U4toI4, U4toI8, U4toU8, U4toF4, U4toF8, implantS, implantB}
+	lenPrep := [...]func([]uint32) any{implantLenS, implantLenB}
+
+	for MaxGor = 1; MaxGor <= 3; MaxGor += 2 {
+		for _, L := range [...]int{2, 1 << 10, 1 << 20} {
+			fillSrc()
+			buf1, buf2 := aaBuf[:L], bbBuf[:L]
+			copy(buf1, srcBuf)
+
+			if SortSliceDesc(buf1); IsSortedSliceDesc(buf1) != 0 {
+				t.Fatal("SortSliceDesc/IsSortedSliceDesc does not work")
+			}
+			if SortSliceDescOf(buf1); IsSortedSliceDescOf(buf1) != 0 {
+				t.Fatal("SortSliceDescOf/IsSortedSliceDescOf does not work")
+			}
+
+			for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+				NaNoption = nan
+				for _, prep := range lsPrep {
+					copy(buf1, srcBuf)
+					copy(buf2, srcBuf)
+					ar, ap := prep(buf1), prep(buf2)
+
+					if SortSliceDesc(ar); IsSortedSliceDesc(ar) != 0 {
+						_, kind := extractSK(ar)
+						t.Fatal("SortSliceDesc does not work, kind:", kind)
+					}
+					SortSlice(ap)
+					reverse(ap)
+					compare(ar, ap)
+				}
+			}
+
+			for _, prep := range lenPrep {
+				copy(buf1, srcBuf)
+				copy(buf2, srcBuf)
+				ar, ap := prep(buf1), prep(buf2)
+
+				if SortLenDesc(ar); IsSortedLenDesc(ar) != 0 {
+					_, kind := extractSK(ar)
+					t.Fatal("SortLenDesc does not work, kind:", kind)
+				}
+				SortLen(ap)
+				reverse(ap)
+				compareLen(ar, ap)
+			}
+		}
+	}
+	NaNoption = NaNlarge
+}
+
+// Sorter values must be independent of package-level values
+func TestSorter(t *testing.T) {
+	tsPtr = t
+	srt := NewSorter()
+	if *srt != (Sorter{MaxGor, GorBudget, NaNoption, MaxLenIns, MaxLenInsFC, MaxLenRec,
+		MaxLenRecFC, [NumKinds]Lengths{}, nil, false}) {
+		t.Fatal("NewSorter() does not work")
+	}
+
+	MaxGor, NaNoption = 1, NaNlarge
+	srt.MaxGor, srt.NaNoption = 4, NaNsmall
+	srt.MaxLenIns, srt.MaxLenRec = 20, 100
+	srt.MaxLenInsFC, srt.MaxLenRecFC = 10, 50
+
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	lsPrep := [...]func([]uint32) any{U4toI8, U4toF4, U4toF8, implantS}
+
+	for _, prep := range lsPrep {
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		ar, ap := prep(buf1), prep(buf2)
+
+		if srt.SortSlice(ar); srt.IsSortedSlice(ar) != 0 {
+			t.Fatal("Sorter.SortSlice() does not work")
+		}
+		NaNoption = NaNsmall
+		SortSlice(ap)
+		NaNoption = NaNlarge
+		compare(ar, ap)
+	}
+
+	copy(buf1, srcBuf)
+	copy(buf2, srcBuf)
+	ar, ap := implantLenB(buf1), implantLenB(buf2)
+	if srt.SortLen(ar); IsSortedLen(ar) != 0 {
+		t.Fatal("Sorter.SortLen() does not work")
+	}
+	SortLen(ap)
+	compareLen(ar, ap)
+
+	copy(buf1, srcBuf)
+	copy(buf2, srcBuf)
+	srt.Sort(len(buf1), func(i, k, r, s int) bool {
+		if buf1[i] < buf1[k] {
+			if r != s {
+				buf1[r], buf1[s] = buf1[s], buf1[r]
+			}
+			return true
+		}
+		return false
+	})
+	SortSlice(buf2)
+	compare(buf1, buf2)
+
+	srt.MaxLenRec = 2 * srt.MaxLenIns // invalid
+	defer func() {
+		MaxGor = AutoGor
+		if recover() == nil {
+			t.Fatal("invalid Sorter values must panic")
+		}
+	}()
+	srt.SortSlice(buf1)
+}
+
+// canceled sorts must stop all goroutines and keep a permutation of input
+func TestContext(t *testing.T) {
+	tsPtr = t
+	MaxGor = 3
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	ctx, cancel := context.WithCancel(context.Background())
+
+	copy(buf1, srcBuf)
+	copy(buf2, srcBuf)
+	if SortSliceContext(ctx, buf1) != nil || SortLenContext(ctx, implantLenS(buf2)) != nil {
+		t.Fatal("SortSliceContext/SortLenContext must not fail")
+	}
+	if IsSortedSlice(buf1) != 0 || IsSortedLen(implantLenS(buf2)) != 0 {
+		t.Fatal("SortSliceContext/SortLenContext does not work")
+	}
+
+	nGor := runtime.NumGoroutine()
+	var calls uint32
+	lsw := func(i, k, r, s int) bool {
+		if atomic.AddUint32(&calls, 1) == 1<<18 {
+			cancel() // cancel in the middle of sorting
+		}
+		if buf1[i] < buf1[k] {
+			if r != s {
+				buf1[r], buf1[s] = buf1[s], buf1[r]
+			}
+			return true
+		}
+		return false
+	}
+
+	copy(buf1, srcBuf)
+	if SortContext(ctx, len(buf1), lsw) != context.Canceled {
+		t.Fatal("SortContext must be canceled")
+	}
+	for i := 0; runtime.NumGoroutine() > nGor; i++ {
+		if i > 99 { // helpers may still be exiting after their last send
+			t.Fatal("SortContext must stop all goroutines")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if IsSortedSlice(buf1) == 0 {
+		t.Fatal("SortContext must stop early")
+	}
+
+	copy(buf2, srcBuf)
+	SortSlice(buf1)
+	SortSlice(buf2)
+	compare(buf1, buf2) // buf1 was a permutation of input
+
+	copy(buf1, srcBuf)
+	if SortSliceContext(ctx, U4toF4(buf1)) != context.Canceled {
+		t.Fatal("SortSliceContext must be canceled")
+	}
+	SortSlice(buf1)
+	compare(buf1, buf2)
+	MaxGor = AutoGor
+}
+
+// SortStable must keep original order of equal keys
+func TestStable(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<19], bbBuf[:1<<19]
+
+	// key in upper 13 bits (many duplicates), original position in lower 19 bits
+	lsw := func(i, k, r, s int) bool {
+		if buf1[i]>>19 < buf1[k]>>19 {
+			if r != s {
+				buf1[r], buf1[s] = buf1[s], buf1[r]
+			}
+			return true
+		}
+		return false
+	}
+
+	for _, n := range [...]int{0, 1, 2, 3, 31, 32, 301, 1000, len(buf1)} {
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for i := 0; i < n; i++ {
+				buf1[i] = srcBuf[i]>>19<<19 | uint32(i)
+			}
+			copy(buf2[:n], buf1[:n])
+
+			SortStable(n, lsw)
+			SortSlice(buf2[:n])
+			compare(buf1[:n], buf2[:n]) // sorted & stable
+		}
+	}
+	MaxGor = AutoGor
+}
+
+// call long*() on ar with given partitioning budget
+func longSK(ar any, byLen, desc bool, depth int, sv *syncVar) {
+	switch a := ar.(type) {
+	case []uint64:
+		if desc {
+			longDescU8(a, depth, sv)
+		} else {
+			longU8(a, depth, sv)
+		}
+	case []int32:
+		if desc {
+			longDescI4(a, depth, sv)
+		} else {
+			longI4(a, depth, sv)
+		}
+	case []int64:
+		if desc {
+			longDescI8(a, depth, sv)
+		} else {
+			longI8(a, depth, sv)
+		}
+	case []float32:
+		if desc {
+			longDescF4(a, depth, sv)
+		} else {
+			longF4(a, depth, sv)
+		}
+	case []float64:
+		if desc {
+			longDescF8(a, depth, sv)
+		} else {
+			longF8(a, depth, sv)
+		}
+	case []string:
+		switch {
+		case byLen && desc:
+			longDescLenS(a, depth, sv)
+		case byLen:
+			longLenS(a, depth, sv)
+		case desc:
+			longDescS(a, depth, sv)
+		default:
+			longS(a, depth, sv)
+		}
+	case [][]byte:
+		switch {
+		case byLen && desc:
+			longDescLenB(a, depth, sv)
+		case byLen:
+			longLenB(a, depth, sv)
+		case desc:
+			longDescB(a, depth, sv)
+		default:
+			longB(a, depth, sv)
+		}
+	default:
+		tsPtr.Fatal("unrecognized type:", reflect.TypeOf(ar))
+	}
+}
+
+// heapsort fallback must sort properly when partitioning budget is exhausted
+func TestIntro(t *testing.T) {
+	tsPtr = t
+	MaxGor = 1
+	fillSrc()
+	for i := range srcBuf {
+		srcBuf[i] &^= 1 << 30 // no NaNs
+	}
+	buf1, buf2 := aaBuf[:1<<16], bbBuf[:1<<16]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toI8, U4toF4, U4toF8,
+		implantS, implantB, implantLenS, implantLenB}
+
+	for depth := 0; depth < 5; depth += 2 {
+		for i, prep := range lsPrep {
+			byLen := i >= len(lsPrep)-2
+
+			for _, desc := range [...]bool{false, true} {
+				copy(buf1, srcBuf)
+				copy(buf2, srcBuf)
+				ar, ap := prep(buf1), prep(buf2)
+				longSK(ar, byLen, desc, depth, std.newVar(!byLen && i >= 5))
+
+				switch {
+				case byLen && desc:
+					SortLenDesc(ap)
+					compareLen(ar, ap)
+				case byLen:
+					SortLen(ap)
+					compareLen(ar, ap)
+				case desc:
+					SortSliceDesc(ap)
+					compare(ar, ap)
+				default:
+					SortSlice(ap)
+					compare(ar, ap)
+				}
+			}
+		}
+
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		long(func(i, k, r, s int) bool {
+			if buf1[i] < buf1[k] {
+				if r != s {
+					buf1[r], buf1[s] = buf1[s], buf1[r]
+				}
+				return true
+			}
+			return false
+		}, 0, len(buf1)-1, depth, std.newVar(true))
+		SortSlice(buf2)
+		compare(buf1, buf2)
+	}
+	MaxGor = AutoGor
+	fillSrc() // restore random source
+}
+
+// presorted inputs must be sorted properly
+func TestPresorted(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		for _, p := range presorted {
+			for _, n := range [...]int{MaxLenRec + 1, len(buf1)} {
+				p.fill(buf1[:n])
+				copy(buf2, buf1[:n])
+				ar, ap := U4toF4(buf1[:n]), U4toF4(buf2[:n])
+				SortSlice(ar)
+				stdSort(ap)
+				compare(ar, ap)
+
+				p.fill(buf1[:n])
+				copy(buf2, buf1[:n])
+				SortSliceDesc(buf1[:n])
+				SortSlice(buf2[:n])
+				reverse(buf2[:n])
+				compare(buf1[:n], buf2[:n])
+
+				p.fill(buf1[:n])
+				copy(buf2, buf1[:n])
+				sortLsw(buf1[:n])
+				stdSort(buf2[:n])
+				compare(buf1[:n], buf2[:n])
+			}
+		}
+	}
+	MaxGor = AutoGor
+}
+
+// inputs with few distinct values must be sorted properly
+func TestDuplicates(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	for i := range srcBuf {
+		srcBuf[i] &= 15
+	}
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toF4, U4toF8, implantS, implantB}
+
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		for _, prep := range lsPrep {
+			copy(buf1, srcBuf)
+			copy(buf2, srcBuf)
+			ar, ap := prep(buf1), prep(buf2)
+			SortSlice(ar)
+			stdSort(ap)
+			compare(ar, ap)
+
+			copy(buf1, srcBuf)
+			copy(buf2, srcBuf)
+			ar, ap = prep(buf1), prep(buf2)
+			SortSliceDesc(ar)
+			SortSlice(ap)
+			reverse(ap)
+			compare(ar, ap)
+		}
+
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		sortLsw(buf1)
+		stdSort(buf2)
+		compare(buf1, buf2)
+	}
+	MaxGor = AutoGor
+	fillSrc() // restore random source
+}
+
+// radix sort must agree with SortSlice
+func TestRadix(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	lsPrep := [...]func([]uint32) any{nil, U4toU8, U4toI4, U4toI8, U4toF4, U4toF8}
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		NaNoption = nan
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for _, prep := range lsPrep {
+				for _, n := range [...]int{0, 1, 2, 300, len(buf1)} {
+					copy(buf1, srcBuf)
+					copy(buf2, srcBuf)
+					var ar, ap any = buf1[:n], buf2[:n]
+					if prep != nil {
+						ar, ap = prep(buf1[:n]), prep(buf2[:n])
+					}
+					SortSliceRadix(ar)
+					SortSlice(ap)
+					if n > 0 {
+						compare(ar, ap)
+					}
+				}
+			}
+		}
+	}
+	NaNoption = NaNlarge
+	MaxGor = AutoGor
+
+	// small ranges skip passes
+	for i := range buf1 {
+		buf1[i] = srcBuf[i] & 255
+		buf2[i] = buf1[i]
+	}
+	SortSliceRadix(buf1)
+	SortSlice(buf2)
+	compare(buf1, buf2)
+
+	for _, ar := range [...]any{[]string{"a"}, []*int{nil}, 1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("SortSliceRadix must panic for", reflect.TypeOf(ar))
+				}
+			}()
+			SortSliceRadix(ar)
+		}()
+	}
+}
+
+// k smallest members must be sorted at the front
+func TestPartial(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toI8, U4toF4, U4toF8, implantS, implantB}
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		NaNoption = nan
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for _, prep := range lsPrep {
+				for _, k := range [...]int{-1, 0, 1, 100, 1 << 14, 1 << 30} {
+					copy(buf1, srcBuf)
+					copy(buf2, srcBuf)
+					ar, ap := prep(buf1), prep(buf2)
+					PartialSortSlice(ar, k)
+					SortSlice(ap)
+
+					slc1, slc2, _ := basicCheck(ar, ap)
+					if k > slc1.Len {
+						k = slc1.Len
+					} else if k < 0 {
+						k = 0
+					}
+					slc1.Len, slc2.Len = k, k
+					slc1.Cap, slc2.Cap = k, k
+					rf := reflect.TypeOf(ar)
+					compare(reflect.NewAt(rf, unsafe.Pointer(&slc1)).Elem().Interface(),
+						reflect.NewAt(rf, unsafe.Pointer(&slc2)).Elem().Interface())
+				}
+			}
+
+			copy(buf1, srcBuf)
+			copy(buf2, srcBuf)
+			PartialSort(len(buf1), 1<<14, func(i, k, r, s int) bool {
+				if buf1[i] < buf1[k] {
+					if r != s {
+						buf1[r], buf1[s] = buf1[s], buf1[r]
+					}
+					return true
+				}
+				return false
+			})
+			SortSlice(buf2)
+			compare(buf1[:1<<14], buf2[:1<<14])
+		}
+	}
+	NaNoption = NaNlarge
+	MaxGor = AutoGor
+}
+
+// members at requested ranks must be as if sorted
+func TestSelect(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<20], bbBuf[:1<<20]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toI8, U4toF4, U4toF8, implantS, implantB}
+	ranks := func(n int) [][]int { // requested ranks for length n
+		return [][]int{{0}, {n - 1}, {5, 5, n / 2}, {9, n / 8, n - 2, n / 4, 99},
+			QuantileRanks(n, 0, 0.5, 0.9, 0.99, 0.999, 1)}
+	}
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		NaNoption = nan
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for _, prep := range lsPrep {
+				copy(buf1, srcBuf)
+				for _, ks := range ranks(reflect.ValueOf(prep(buf1)).Len()) {
+					copy(buf1, srcBuf)
+					copy(buf2, srcBuf)
+					ar, ap := prep(buf1), prep(buf2)
+					if len(ks) == 1 {
+						NthElementSlice(ar, ks[0])
+					} else {
+						SelectSlice(ar, ks...)
+					}
+					SortSlice(ap)
+
+					// collect members at ranks
+					v1, v2 := reflect.ValueOf(ar), reflect.ValueOf(ap)
+					s1 := reflect.MakeSlice(v1.Type(), len(ks), len(ks))
+					s2 := reflect.MakeSlice(v1.Type(), len(ks), len(ks))
+					for i, k := range ks {
+						s1.Index(i).Set(v1.Index(k))
+						s2.Index(i).Set(v2.Index(k))
+					}
+					compare(s1.Interface(), s2.Interface())
+				}
+			}
+
+			for _, ks := range ranks(len(buf1)) {
+				copy(buf1, srcBuf)
+				copy(buf2, srcBuf)
+				lsw := func(i, k, r, s int) bool {
+					if buf1[i] < buf1[k] {
+						if r != s {
+							buf1[r], buf1[s] = buf1[s], buf1[r]
+						}
+						return true
+					}
+					return false
+				}
+				if len(ks) == 1 {
+					NthElement(len(buf1), ks[0], lsw)
+				} else {
+					Select(len(buf1), lsw, ks...)
+				}
+				SortSlice(buf2)
+
+				for _, k := range ks {
+					if buf1[k] != buf2[k] {
+						t.Fatal("Select: wrong member at", k)
+					}
+				}
+				k := ks[0] // check partitioning around first rank
+				for i := range buf1 {
+					if i < k && buf1[i] > buf1[k] || i > k && buf1[i] < buf1[k] {
+						t.Fatal("Select: not partitioned at", i)
+					}
+				}
+			}
+		}
+	}
+	NaNoption = NaNlarge
+	MaxGor = AutoGor
+
+	for _, f := range [...]func(){
+		func() { NthElementSlice([]int{1}, 1) },
+		func() { SelectSlice([]float64{1}, 0, -1) },
+		func() { QuantileRanks(9, 1.5) },
+		func() { NthElementSlice([]bool{true}, 0) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Select: invalid input must panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+// permutation from arg sorting must sort input, which is not modified
+func TestArgSort(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<19], bbBuf[:1<<19]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toI8, U4toF4, U4toF8, implantS, implantB}
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		NaNoption = nan
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for _, prep := range lsPrep {
+				copy(buf1, srcBuf)
+				copy(buf2, srcBuf)
+				ar, ap := prep(buf1), prep(buf2)
+
+				p := ArgSortSlice(ar)
+				compare(ar, ap) // not modified
+				SortSlice(ap)
+
+				v1 := reflect.ValueOf(ar)
+				if len(p) != v1.Len() {
+					t.Fatal("ArgSortSlice: wrong length")
+				}
+				s1 := reflect.MakeSlice(v1.Type(), len(p), len(p))
+				for i, k := range p {
+					s1.Index(i).Set(v1.Index(k))
+				}
+				compare(s1.Interface(), ap)
+			}
+		}
+	}
+	NaNoption = NaNignore
+	copy(buf1, srcBuf)
+	cycles(ArgSortSlice(U4toF8(buf1))) // panics if not a permutation
+	NaNoption = NaNlarge
+	MaxGor = AutoGor
+
+	// few distinct keys, equal keys must keep index order
+	for i := range buf1 {
+		buf1[i] = srcBuf[i] & 15
+	}
+	less := func(i, k int) bool { return buf1[i] < buf1[k] }
+	for r, p := range [...][]int{ArgSort(len(buf1), less), ArgSortStable(len(buf1), less),
+		ArgSortSlice(buf1)} {
+
+		if len(p) != len(buf1) {
+			t.Fatal("ArgSort: wrong length")
+		}
+		for i := 1; i < len(p); i++ {
+			a, b := buf1[p[i-1]], buf1[p[i]]
+			if a > b || a == b && r > 0 && p[i-1] > p[i] {
+				t.Fatal("ArgSort: not sorted at", i)
+			}
+		}
+	}
+}
+
+// payloads must move in lockstep with their keys
+func TestSortPairs(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<19], bbBuf[:1<<19]
+	lsPrep := [...]func([]uint32) any{U4toU8, U4toI4, U4toI8, U4toF4, U4toF8, implantS, implantB}
+	nGor := runtime.NumGoroutine()
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		NaNoption = nan
+		for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+			for _, prep := range lsPrep {
+				copy(buf1, srcBuf)
+				copy(buf2, srcBuf)
+				ar, ap := prep(buf1), prep(buf2)
+				v1, v2 := reflect.ValueOf(ar), reflect.ValueOf(ap)
+
+				// original positions as payloads of different types, last
+				// one is moved via reflection
+				pos, pos2 := make([]int, v1.Len()), make([]string, v1.Len())
+				pos3 := make([]keyRec, v1.Len())
+				for i := range pos {
+					pos[i] = i
+					pos2[i] = strconv.Itoa(i)
+					pos3[i].id = i
+				}
+				SortPairs(ar, pos, pos2, pos3)
+
+				s2 := reflect.MakeSlice(v1.Type(), len(pos), len(pos))
+				for i, k := range pos {
+					if pos2[i] != strconv.Itoa(k) || pos3[i].id != k {
+						t.Fatal("SortPairs: payloads mismatch at", i)
+					}
+					s2.Index(i).Set(v2.Index(k))
+				}
+				compare(ar, s2.Interface()) // keys moved with payloads
+
+				SortSlice(ap)
+				compare(ar, ap)
+			}
+		}
+	}
+	NaNoption = NaNlarge
+	MaxGor = AutoGor
+
+	// helpers of sorting & moving must all end
+	for i := 0; runtime.NumGoroutine() > nGor; i++ {
+		if i > 99 {
+			t.Fatal("SortPairs: goroutines leaked:", runtime.NumGoroutine()-nGor)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, f := range [...]func(){
+		func() { SortPairs([]int{1, 2}, []int{1}) },
+		func() { SortPairs([]int{1, 2}, 3) },
+		func() { SortPairs([]bool{true}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("SortPairs: invalid input must panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+type keyRec struct {
+	id  int
+	val uint32
+}
+
+// checkByKey sorts recs by key, checks key order, call count and that recs is a permutation
+func checkByKey[K Ordered](recs []keyRec, key func(uint32) K, srt *Sorter) {
+	var calls uint64
+	SortByKeyWith(srt, recs, func(r keyRec) K {
+		atomic.AddUint64(&calls, 1)
+		return key(r.val)
+	})
+	if calls != uint64(len(recs)) {
+		tsPtr.Fatal("SortByKey: key() called", calls, "times for", len(recs))
+	}
+
+	seen := make([]bool, len(recs))
+	for i, r := range recs {
+		if seen[r.id] {
+			tsPtr.Fatal("SortByKey: not a permutation")
+		}
+		seen[r.id] = true
+		if i > 0 {
+			a, b := key(recs[i-1].val), key(r.val)
+			if b < a || a != a && b == b && srt.NaNoption == NaNlarge ||
+				b != b && a == a && srt.NaNoption == NaNsmall {
+				tsPtr.Fatal("SortByKey: not sorted at", i)
+			}
+			if (a == b || a != a && b != b) && recs[i-1].id > r.id {
+				tsPtr.Fatal("SortByKey: not stable at", i)
+			}
+		}
+	}
+}
+
+// members must be sorted by their cached keys
+func TestSortByKey(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	recs := make([]keyRec, 1<<18)
+	srt := NewSorter()
+	nGor := runtime.NumGoroutine()
+
+	for _, nan := range [...]FloatOption{NaNsmall, NaNlarge} {
+		srt.NaNoption = nan
+		for srt.MaxGor = 1; srt.MaxGor < 5; srt.MaxGor += 3 {
+			for r := 0; r < 7; r++ {
+				for i := range recs {
+					recs[i] = keyRec{i, srcBuf[i]}
+				}
+				switch r {
+				case 0:
+					checkByKey(recs, func(x uint32) int8 { return int8(x) }, srt)
+				case 1:
+					checkByKey(recs, func(x uint32) uint16 { return uint16(x >> 9) }, srt)
+				case 2:
+					checkByKey(recs, func(x uint32) int32 { return int32(x) }, srt)
+				case 3:
+					checkByKey(recs, func(x uint32) uint32 { return x }, srt)
+				case 4:
+					checkByKey(recs, func(x uint32) int { return int(int32(x)) * 3 }, srt)
+				case 5:
+					checkByKey(recs, func(x uint32) float64 {
+						return float64(math.Float32frombits(x)) // has NaNs
+					}, srt)
+				default:
+					checkByKey(recs, func(x uint32) string { return strconv.Itoa(int(x)) }, srt)
+				}
+			}
+		}
+	}
+
+	// helpers of key caching, sorting & moving must all end
+	for i := 0; runtime.NumGoroutine() > nGor; i++ {
+		if i > 99 {
+			t.Fatal("SortByKey: goroutines leaked:", runtime.NumGoroutine()-nGor)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// widened keys of inputs too long to pack
+	ks := make([]int8, len(recs))
+	for i := range ks {
+		ks[i] = int8(srcBuf[i])
+	}
+	p := identity(len(ks))
+	argNative(keys32(ks, 1<<7), p, std.kindVar(KindU4))
+	for i := 1; i < len(p); i++ {
+		if a, b := ks[p[i-1]], ks[p[i]]; b < a || a == b && p[i-1] > p[i] {
+			t.Fatal("keys32: not sorted at", i)
+		}
+	}
+}
+
+// applied permutations must sort, inverted ones must undo
+func TestPermutation(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<19], bbBuf[:1<<19]
+
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		copy(buf2, srcBuf)
+		perm := ArgSortSlice(buf2)
+		SortSlice(buf2)
+
+		for r := 0; r < 3; r++ {
+			copy(buf1, srcBuf)
+			switch r {
+			case 0:
+				ApplyPermutation(buf1, perm)
+			case 1:
+				ApplyPermutationOf(buf1, perm)
+			default:
+				ApplyPermutationSwap(perm, func(i, k int) { buf1[i], buf1[k] = buf1[k], buf1[i] })
+			}
+			compare(buf1, buf2)
+		}
+
+		inv := append([]int(nil), perm...)
+		InvertPermutation(inv)
+		for i, k := range perm {
+			if inv[k] != i {
+				t.Fatal("InvertPermutation: wrong inverse at", k)
+			}
+		}
+		ApplyPermutationOf(buf1, inv) // undo sorting
+		compare(buf1, srcBuf[:len(buf1)])
+	}
+	MaxGor = AutoGor
+
+	for _, p := range [...][]int{{1, 1}, {0, 0}, {2, 0}, {-1}, {1, 2, 0, 4}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("invalid permutation must panic", p)
+				}
+			}()
+			InvertPermutation(p)
+		}()
+	}
+}
+
+// rows must be in order of column specs, stable
+func TestSortColumns(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	const n = 1 << 17
+	a, b, c := make([]int64, n), make([]float64, n), make([]string, n)
+	null, id := make([]bool, n), make([]int, n)
+
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		for i := range id {
+			x := srcBuf[i]
+			a[i] = int64(x&3) - 1
+			b[i] = float64(x >> 2 & 7)
+			if x>>5&15 == 0 {
+				b[i] = math.NaN()
+			}
+			null[i] = x>>9&15 == 0
+			c[i] = strconv.Itoa(int(x >> 13 & 15))
+			id[i] = i
+		}
+		cols := []Column{{Data: a, Desc: true}, {Data: b, Null: null, Nulls: NullsFirst}, {Data: c}}
+		p := ColumnPerm(cols...)
+		SortColumns(cols, id)
+
+		for i := range id {
+			if p[i] != id[i] {
+				t.Fatal("SortColumns: permutation mismatch at", i)
+			}
+		}
+		for i := 1; i < n; i++ {
+			q, r := i-1, i // previous & current rows
+			if a[q] != a[r] {
+				if a[q] < a[r] {
+					t.Fatal("SortColumns: column a not descending at", i)
+				}
+				continue
+			}
+			nq, nr := null[q] || b[q] != b[q], null[r] || b[r] != b[r]
+			if nq != nr {
+				if nr {
+					t.Fatal("SortColumns: null not first at", i)
+				}
+				continue
+			}
+			if !nq && b[q] != b[r] {
+				if b[q] > b[r] {
+					t.Fatal("SortColumns: column b not ascending at", i)
+				}
+				continue
+			}
+			if c[q] != c[r] {
+				if c[q] > c[r] {
+					t.Fatal("SortColumns: column c not ascending at", i)
+				}
+				continue
+			}
+			if id[q] > id[r] {
+				t.Fatal("SortColumns: not stable at", i)
+			}
+		}
+	}
+	MaxGor = AutoGor
+
+	// descending byte slices with nulls last
+	bs := make([][]byte, n)
+	for i := range bs {
+		bs[i] = []byte(c[i])
+	}
+	p := ColumnPerm(Column{Data: bs, Null: null, Desc: true})
+	for i := 1; i < n; i++ {
+		q, r := p[i-1], p[i]
+		if null[q] != null[r] {
+			if null[q] {
+				t.Fatal("ColumnPerm: null not last at", i)
+			}
+			continue
+		}
+		if !null[q] && c[q] != c[r] {
+			if c[q] < c[r] {
+				t.Fatal("ColumnPerm: column not descending at", i)
+			}
+			continue
+		}
+		if q > r {
+			t.Fatal("ColumnPerm: not stable at", i)
+		}
+	}
+
+	for _, f := range [...]func(){
+		func() { ColumnPerm() },
+		func() { ColumnPerm(Column{Data: a}, Column{Data: c[1:]}) },
+		func() { ColumnPerm(Column{Data: a, Null: null[1:]}) },
+		func() { ColumnPerm(Column{Data: []bool{true}}) },
+		func() { SortColumns([]Column{{Data: a}}, id[1:]) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("SortColumns: invalid input must panic")
+				}
+			}()
+			f()
+		}()
+	}
+}
+
+type orderRow struct {
+	t    int64
+	name string
+	f    float64
+}
+
+// built lesswap must honor the contract and sort as per its order
+func TestOrder(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	rows := make([]orderRow, 1<<17)
+	for i := range rows {
+		x := srcBuf[i]
+		rows[i] = orderRow{int64(x&7) - 3, strconv.Itoa(int(x >> 3 & 7)), float64(x >> 6 & 7)}
+		if x>>9&7 == 0 {
+			rows[i].f = math.NaN()
+		}
+	}
+
+	swaps := 0
+	swap := func(i, k int) {
+		swaps++
+		rows[i], rows[k] = rows[k], rows[i]
+	}
+	order := By(func(i int) int64 { return rows[i].t }).
+		ThenBy(By(func(i int) string { return rows[i].name }).Desc()).
+		ThenBy(By(func(i int) float64 { return rows[i].f }).NaN(NaNsmall))
+	lsw := order.Lesswap(swap)
+
+	// reference comparison
+	less := func(a, b *orderRow) bool {
+		if a.t != b.t {
+			return a.t < b.t
+		}
+		if a.name != b.name {
+			return a.name > b.name
+		}
+		return a.f < b.f || a.f != a.f && b.f == b.f // small NaNs
+	}
+
+	same := func(a, b orderRow) bool { // NaNs are same
+		return a.t == b.t && a.name == b.name && math.Float64bits(a.f) == math.Float64bits(b.f)
+	}
+
+	// contract checks on random members
+	for c := 0; c < 1<<16; c++ {
+		i, k := int(srcBuf[c]>>15)%len(rows), int(srcBuf[c+1]>>15)%len(rows)
+		r := less(&rows[i], &rows[k])
+		if lsw(i, i, i, k) || lsw(i, k, i, i) != r || swaps != 0 {
+			t.Fatal("Order: broken contract at", i, k)
+		}
+		if r && lsw(k, i, i, k) {
+			t.Fatal("Order: not strict at", i, k)
+		}
+		a, b := rows[i], rows[k]
+		if lsw(i, k, i, k) != r {
+			t.Fatal("Order: wrong result at", i, k)
+		}
+		if r && (swaps != 1 || !same(rows[i], b) || !same(rows[k], a)) || !r && swaps != 0 {
+			t.Fatal("Order: wrong swap at", i, k)
+		}
+		if swaps != 0 {
+			swap(i, k) // undo
+			swaps = 0
+		}
+	}
+
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		Sort(len(rows), lsw)
+		if IsSorted(len(rows), lsw) != 0 {
+			t.Fatal("Order: not sorted")
+		}
+		for i := 1; i < len(rows); i++ {
+			if less(&rows[i], &rows[i-1]) {
+				t.Fatal("Order: not sorted as per reference at", i)
+			}
+		}
+		desc := order.Desc().Lesswap(swap)
+		Sort(len(rows), desc)
+		for i := 1; i < len(rows); i++ {
+			if less(&rows[i-1], &rows[i]) {
+				t.Fatal("Order: not reverse sorted at", i)
+			}
+		}
+	}
+	MaxGor = AutoGor
+}
+
+// broken lesswaps must be reported without corrupting data
+func TestCheckedSort(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<18], bbBuf[:1<<18]
+	copy(buf1, srcBuf)
+	copy(buf2, srcBuf)
+
+	good := func(i, k, r, s int) bool {
+		if buf1[i] < buf1[k] {
+			if r != s {
+				buf1[r], buf1[s] = buf1[s], buf1[r]
+			}
+			return true
+		}
+		return false
+	}
+	if err := CheckedSort(len(buf1), good); err != nil {
+		t.Fatal(err)
+	}
+	SortSlice(buf2)
+	compare(buf1, buf2)
+
+	var calls uint64
+	broken := [...]Lesswap{
+		func(i, k, r, s int) bool { // not strict
+			if buf1[i] <= buf1[k] {
+				if r != s {
+					buf1[r], buf1[s] = buf1[s], buf1[r]
+				}
+				return true
+			}
+			return false
+		},
+		func(i, k, r, s int) bool { // xor swap without r != s check
+			if buf1[i] < buf1[k] {
+				buf1[r] ^= buf1[s]
+				buf1[s] ^= buf1[r]
+				buf1[r] ^= buf1[s]
+				return true
+			}
+			return false
+		},
+		func(i, k, r, s int) bool { // not transitive
+			return (buf1[i]-buf1[k])%3 == 1
+		},
+		func(i, k, r, s int) bool { // no swap
+			return buf1[i] < buf1[k]
+		},
+		func(i, k, r, s int) bool { // out of range
+			return buf1[:len(buf1)/2][i] < buf1[k]
+		},
+		func(i, k, r, s int) bool { // panics during sorting
+			if atomic.AddUint64(&calls, 1) > 1<<16 {
+				panic("enough")
+			}
+			return good(i, k, r, s)
+		},
+	}
+	for MaxGor = 1; MaxGor < 5; MaxGor += 3 {
+		for c, lsw := range broken {
+			copy(buf1, srcBuf)
+			for i := range buf1 {
+				buf1[i] &= 1<<20 - 1 // some duplicates
+			}
+			calls = 0
+			if err := CheckedSort(len(buf1), lsw); err == nil {
+				t.Fatal("CheckedSort: broken lesswap", c, "not detected")
+			}
+		}
+	}
+	MaxGor = AutoGor
+}
+
+func TestPanic(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	buf := aaBuf[:1<<18]
+	nGor := runtime.NumGoroutine()
+
+	var calls uint64
+	lsw := func(i, k, r, s int) bool {
+		if atomic.AddUint64(&calls, 1) > 1<<17 {
+			panic("enough")
+		}
+		if buf[i] < buf[k] {
+			if r != s {
+				buf[r], buf[s] = buf[s], buf[r]
+			}
+			return true
+		}
+		return false
+	}
+	swap := func(i, k int) {
+		if atomic.AddUint64(&calls, 1) > 1<<15 {
+			panic("enough")
+		}
+		buf[i], buf[k] = buf[k], buf[i]
+	}
+	perm := identity(len(buf))
+	for i := len(perm) - 1; i > 0; i-- { // a long cycle
+		perm[i], perm[i-1] = perm[i-1], perm[i]
+	}
+	calls = 0
+	ApplyPermutationSwap(perm, func(i, k int) {}) // check perm
+
+	fns := [...]func(){
+		func() { Sort(len(buf), lsw) },
+		func() { SortStable(len(buf), lsw) },
+		func() { ArgSort(len(buf), func(i, k int) bool { return lsw(i, k, 0, 0) }) },
+		func() {
+			SortByKey(buf, func(x uint32) uint32 {
+				if atomic.AddUint64(&calls, 1) > 1<<15 {
+					panic("enough")
+				}
+				return x
+			})
+		},
+		func() { ApplyPermutationSwap(perm, swap) },
+	}
+	for MaxGor = 1; MaxGor < 9; MaxGor += 7 {
+		for c, f := range fns {
+			copy(buf, srcBuf)
+			calls = 0
+			func() {
+				defer func() {
+					p := recover()
+					if hp, ok := p.(*HelperPanic); ok {
+						if len(hp.Stack) == 0 || hp.Unwrap() != nil {
+							t.Fatal("HelperPanic: bad stack or unwrap", c)
+						}
+						p = hp.Value
+					}
+					if p != "enough" {
+						t.Fatal("panic not propagated:", c, p)
+					}
+				}()
+				f()
+			}()
+		}
+	}
+	MaxGor = AutoGor
+
+	// helpers are awaited before panicking on the caller
+	for i := 0; runtime.NumGoroutine() > nGor; i++ {
+		if i > 99 {
+			t.Fatal("goroutines leaked:", runtime.NumGoroutine()-nGor)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	const callers, L = 8, 1 << 17
+	b := &Budget{}
+	srt := NewSorter()
+	srt.MaxGor, srt.Budget = 8, b
+
+	// empty budget: no helpers
+	buf := aaBuf[:L]
+	copy(buf, srcBuf)
+	srt.SortSlice(buf)
+	if i := IsSortedSlice(buf); i != 0 || b.Used() != 0 {
+		t.Fatal("Budget: zero Max does not work", i)
+	}
+
+	b.Max = 2
+	stop := make(chan uint64)
+	go func() { // sample used helpers
+		var peak uint64
+		for {
+			select {
+			case stop <- peak:
+				return
+			default:
+			}
+			if u := b.Used(); u > peak {
+				peak = u
+			}
+			runtime.Gosched()
+		}
+	}()
+
+	ch := make(chan int)
+	for c := 0; c < callers; c++ {
+		go func(c int) {
+			buf := aaBuf[c*L : (c+1)*L]
+			for r := 0; r < 4; r++ {
+				copy(buf, srcBuf[c*L:])
+				srt.SortSlice(buf)
+				srt.SortStable(len(buf), func(i, k, r, s int) bool {
+					if buf[i]>>8 < buf[k]>>8 {
+						if r != s {
+							buf[r], buf[s] = buf[s], buf[r]
+						}
+						return true
+					}
+					return false
+				})
+				srt.Sort(len(buf), func(i, k, r, s int) bool {
+					if buf[i] > buf[k] { // descending
+						if r != s {
+							buf[r], buf[s] = buf[s], buf[r]
+						}
+						return true
+					}
+					return false
+				})
+			}
+			ch <- IsSortedSliceDesc(buf)
+		}(c)
+	}
+	for c := 0; c < callers; c++ {
+		if i := <-ch; i != 0 {
+			t.Fatal("Budget: not sorted", i)
+		}
+	}
+	peak := <-stop
+
+	// helpers are drawn atomically, so budget is never exceeded
+	if b.Used() != 0 || peak == 0 || peak > b.Max {
+		t.Fatal("Budget: bad helper count", b.Used(), peak)
+	}
+}
+
+func TestAutoGor(t *testing.T) {
+	tsPtr = t
+	root, self, procs := cgroupRoot, cgroupSelf, uint64(runtime.GOMAXPROCS(0))
+	defer func() {
+		cgroupRoot, cgroupSelf = root, self
+		refreshQuota()
+	}()
+
+	cgroupRoot = t.TempDir()
+	cgroupSelf = cgroupRoot + "/self" // process cgroups
+	write := func(file, data string) {
+		if err := os.MkdirAll(filepath.Dir(cgroupRoot+file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(cgroupRoot+file, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(quota uint64) {
+		if q := readQuota(); q != quota {
+			t.Fatal("readQuota:", q, "want", quota)
+		}
+		refreshQuota()
+		atomic.StoreInt64(&quotaAt, time.Now().UnixNano()) // not stale
+		want := procs
+		if quota > 0 && quota < want {
+			want = quota
+		}
+		if g := autoGor(); g != want {
+			t.Fatal("autoGor:", g, "want", want)
+		}
+	}
+	check(0) // no cgroup files
+
+	write("/cpu/cpu.cfs_quota_us", "-1\n") // v1 root
+	write("/cpu/cpu.cfs_period_us", "100000\n")
+	check(0)
+	write("/cpu/cpu.cfs_quota_us", "250000\n")
+	check(3)
+
+	write("/self", "4:memory:/app\n3:cpu,cpuacct:/app\n") // v1 own cgroup
+	check(3)
+	write("/cpu/app/cpu.cfs_quota_us", "150000\n")
+	write("/cpu/app/cpu.cfs_period_us", "100000\n")
+	check(2)
+
+	write("/cpu.max", "max 100000\n") // v2 takes precedence
+	check(0)
+	write("/cpu.max", "100000 100000\n")
+	check(1)
+
+	write("/self", "0::/app/job\n") // v2 own cgroup & its ancestors
+	write("/cpu.max", "max 100000\n")
+	check(0)
+	write("/app/cpu.max", "300000 100000\n")
+	write("/app/job/cpu.max", "max 100000\n")
+	check(3)
+	old := autoGor()
+	write("/app/job/cpu.max", "200000 100000\n") // stale quota is refreshed later
+	atomic.StoreInt64(&quotaAt, 0)
+	if g := autoGor(); g != old {
+		t.Fatal("autoGor: stale quota must be refreshed in the background")
+	}
+	for i := 0; atomic.LoadUint64(&quotaCPU) != 2; i++ {
+		if i > 99 {
+			t.Fatal("autoGor: stale quota not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	write("/app/job/cpu.max", "100000 100000\n")
+	check(1)
+
+	// one CPU quota pins calls to single goroutine, explicit MaxGor overrides
+	for _, mg := range [...]uint64{AutoGor, 5} {
+		MaxGor = mg
+		srt := NewSorter()
+		for _, sv := range [...]*syncVar{std.newVar(false), srt.newVar(true)} {
+			if sv.auto != 0 {
+				t.Fatal("newVar: AutoGor must be evaluated on first use")
+			}
+			if g := sv.maxG(); mg == AutoGor && g != 1 || mg != AutoGor && g != mg {
+				t.Fatal("newVar: bad MaxGor", g, "for", mg)
+			}
+
+			// live changes of MaxGor to & from AutoGor stay bounded
+			live := uint64(5)
+			if mg != AutoGor {
+				live = AutoGor
+			}
+			MaxGor, srt.MaxGor = live, live
+			if g := sv.maxG(); mg == AutoGor && g != 5 || mg != AutoGor && g != 1 {
+				t.Fatal("maxG: bad live MaxGor", g, "for", mg)
+			}
+			MaxGor, srt.MaxGor = mg, mg
+		}
+	}
+	MaxGor = AutoGor
+}
+
+func TestCalibrate(t *testing.T) {
+	tsPtr = t
+	srt := Calibrate(300 * time.Millisecond)
+	srt.newVar(false) // panics for invalid values
+	srt.newVar(true)
+	for k := KindI4; k < NumKinds; k++ {
+		if srt.Lens[k] == (Lengths{}) {
+			t.Fatal("Calibrate: Lens not set for", k)
+		}
+		srt.kindVar(k)
+	}
+
+	var st Stats // trial sorts are not collected
+	s3 := NewSorter()
+	s3.Stats = &st
+	s3.Calibrate(50 * time.Millisecond)
+	if st != (Stats{}) {
+		t.Fatal("Calibrate: trial sorts collected into Stats")
+	}
+
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<16], bbBuf[:1<<16]
+	copy(buf1, srcBuf)
+	copy(buf2, srcBuf)
+	srt.SortSlice(buf1)
+	SortSlice(buf2)
+	compare(buf1, buf2)
+
+	file := t.TempDir() + "/profile.json"
+	if err := srt.SaveProfile(file); err != nil {
+		t.Fatal(err)
+	}
+	s2 := NewSorter()
+	if err := s2.LoadProfile(file); err != nil || *s2 != *srt {
+		t.Fatal("LoadProfile does not work", err)
+	}
+
+	for _, bad := range [...]string{`{"MaxLenIns": 5}`, `{"Lens": {"X4": {"Ins": 40, "Rec": 400}}}`,
+		`{"Lens": {"U4": {"Ins": 40, "Rec": 80}}}`} {
+		if err := os.WriteFile(file, []byte(bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := s2.LoadProfile(file); err == nil || *s2 != *srt {
+			t.Fatal("LoadProfile accepted invalid profile", bad)
+		}
+	}
+}
+
+func TestKindLens(t *testing.T) {
+	tsPtr = t
+	srt := NewSorter()
+	for k := KindI4; k < NumKinds; k++ {
+		srt.Lens[k] = Lengths{20 + 4*int(k), 100 + 40*int(k)}
+		if sv := srt.kindVar(k); sv.ins != srt.Lens[k].Ins || sv.rec != srt.Lens[k].Rec {
+			t.Fatal("kindVar: Lens not used for", k)
+		}
+	}
+	if KindLenB.String() != "LenB" || NumKinds.String() != "Kind(10)" {
+		t.Fatal("Kind.String() does not work")
+	}
+
+	fillSrc()
+	buf1, buf2 := aaBuf[:1<<18], bbBuf[:1<<18]
+	lsPrep := [...]func([]uint32) any{U4toI4, U4toI8, nil, U4toU8, U4toF4, U4toF8,
+		implantS, implantB}
+	for _, prep := range lsPrep {
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		ar, ap := any(buf1), any(buf2)
+		if prep != nil {
+			ar, ap = prep(buf1), prep(buf2)
+		}
+		srt.SortSlice(ar)
+		SortSlice(ap)
+		compare(ar, ap)
+	}
+	for _, prep := range [...]func([]uint32) any{implantLenS, implantLenB} {
+		copy(buf1, srcBuf)
+		copy(buf2, srcBuf)
+		ar, ap := prep(buf1), prep(buf2)
+		srt.SortLen(ar)
+		SortLen(ap)
+		compareLen(ar, ap)
+	}
+
+	srt.Lens[KindF8].Rec = 2 * srt.Lens[KindF8].Ins // invalid
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("invalid Sorter.Lens must panic")
+			}
+		}()
+		srt.SortSlice(U4toF8(buf1))
+	}()
+	srt.SortSlice(buf1) // other kinds are still valid
+}
+
+func TestStats(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	var st Stats
+	srt := NewSorter()
+	srt.MaxGor, srt.Stats = 4, &st
+
+	buf := aaBuf[:1<<18]
+	copy(buf, srcBuf)
+	srt.SortSlice(buf)
+	if IsSortedSlice(buf) != 0 {
+		t.Fatal("Stats: not sorted")
+	}
+	var sum uint64
+	for _, c := range st.Imbalance {
+		sum += c
+	}
+	if st.Partitions == 0 || sum != st.Partitions || st.MaxDepth == 0 ||
+		st.MaxDepth > uint64(maxDepth(len(buf))) || st.Goroutines == 0 ||
+		st.MaxGoroutines < 2 || st.Comparisons != 0 || st.Part <= 0 || st.Sort <= 0 {
+		t.Fatalf("Stats: bad concurrent stats %+v", st)
+	}
+
+	st = Stats{}
+	srt.MaxGor = 1
+	copy(buf, srcBuf)
+	srt.Sort(len(buf), func(i, k, r, s int) bool {
+		if buf[i] < buf[k] {
+			if r != s {
+				buf[r], buf[s] = buf[s], buf[r]
+			}
+			return true
+		}
+		return false
+	})
+	if IsSortedSlice(buf) != 0 {
+		t.Fatal("Stats: not sorted")
+	}
+	if st.Comparisons == 0 || st.Swaps == 0 || st.Swaps > st.Comparisons ||
+		st.Partitions == 0 || st.Goroutines != 0 || st.MaxGoroutines != 1 ||
+		st.Part != 0 || st.Wait != 0 || st.Sort <= 0 {
+		t.Fatalf("Stats: bad single-goroutine stats %+v", st)
+	}
+
+	st = Stats{}
+	srt.SortStable(len(buf), func(i, k, r, s int) bool { return false })
+	if st.Comparisons == 0 || st.Swaps != 0 || st.Partitions != 0 {
+		t.Fatalf("Stats: bad stable stats %+v", st)
+	}
+
+	st = Stats{} // sorting of many ranks is not collected
+	ranks := make([]int, 1<<12)
+	for i := range ranks {
+		ranks[i] = (len(ranks) - i) % 32
+	}
+	copy(buf, srcBuf)
+	srt.SelectSlice(buf[:32], ranks...) // short range
+	if st.Partitions != 0 {
+		t.Fatalf("Stats: bad select stats %+v", st)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	tsPtr = t
+	fillSrc()
+	var out bytes.Buffer
+	if err := trace.Start(&out); err != nil {
+		t.Skip("cannot trace:", err)
+	}
+	srt := NewSorter()
+	srt.MaxGor, srt.Trace = 4, true
+
+	buf := aaBuf[:1<<18]
+	copy(buf, srcBuf)
+	srt.SortSlice(buf)
+	if IsSortedSlice(buf) != 0 {
+		trace.Stop()
+		t.Fatal("Trace: not sorted")
+	}
+
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("request", "test"))
+	copy(buf, srcBuf)
+	err := srt.SortContext(ctx, len(buf), func(i, k, r, s int) bool {
+		if buf[i] < buf[k] {
+			if r != s {
+				buf[r], buf[s] = buf[s], buf[r]
+			}
+			return true
+		}
+		return false
+	})
+	trace.Stop()
+	if err != nil || IsSortedSlice(buf) != 0 {
+		t.Fatal("Trace: SortContext does not work", err)
+	}
+
+	for _, name := range [...]string{traceTask, regionPart, regionSort, regionWait} {
+		if !bytes.Contains(out.Bytes(), []byte(name)) {
+			t.Fatal("Trace: missing", name)
+		}
+	}
+}
@@ -70,3 +70,47 @@ func TestOptimize(t *testing.T) {
 		optRun("FC", 40, 300)
 	}
 }
+
+var kindPrep = [NumKinds]func([]uint32) any{U4toI4, U4toI8, nil, U4toU8, U4toF4, U4toF8,
+	implantS, implantB, implantLenS, implantLenB}
+
+// kindSrt carries per-kind max slice lengths being tuned
+var kindSrt = NewSorter()
+
+// return sum of durations of sorting kind k with kindSrt for 1..maxMaxGor goroutines
+func sumDurKind(k Kind) (sum float64) {
+	srf := kindSrt.SortSlice
+	if k >= KindLenS {
+		srf = kindSrt.SortLen
+	}
+	for MaxGor = 1; MaxGor <= maxMaxGor; MaxGor++ {
+		kindSrt.MaxGor = MaxGor
+		sum += medianCpstCompare(stNames[MaxGor-1], kindPrep[k], srf, false)
+	}
+	return
+}
+
+// Optimize per-kind max slice lengths for insertion sort/recursion
+// Takes a long time, run with -tags tuneparam
+func TestOptimizeKinds(t *testing.T) {
+	tsPtr = t
+
+	for k := KindI4; k < NumKinds; k++ {
+		ins0, rec0 := MaxLenIns, MaxLenRec
+		if k == KindS || k == KindB {
+			ins0, rec0 = MaxLenInsFC, MaxLenRecFC
+		}
+		fmt.Printf("\n%v\nLens[Kind%[1]v]:\n", k)
+
+		x, y, _, n := opt.FindMinTri(2, ins0, rec0, ins0/4, rec0/4, func(x, y int) float64 {
+			if x <= 2*nsShort || y <= 2*x {
+				return 9e9 // keep parameters feasible
+			}
+			kindSrt.Lens[k] = Lengths{x, y}
+			return sumDurKind(k)
+		}, optPrint)
+
+		kindSrt.Lens[k] = Lengths{x, y}
+		fmt.Println(n, "calls")
+	}
+}